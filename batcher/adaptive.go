@@ -0,0 +1,68 @@
+package batcher
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// AdaptiveInterval is a batch interval that adapts to how quickly
+// batches are received from the out channel. Pass it to a batcher
+// through Params.Adaptive.
+//
+// When sending a batch blocks for longer than a quarter of the current
+// interval, the receiver is not keeping up, so the interval is doubled
+// to make batches larger and less frequent. When sending a batch does
+// not block at all, the interval is shortened by an eighth, to reduce
+// the latency of items in the batcher. The interval always stays
+// between the minimum and maximum.
+//
+// An AdaptiveInterval may be shared by several batchers that send on
+// the same out channel, such as the sub-batchers of a grouping batcher.
+// It is safe for concurrent use.
+type AdaptiveInterval struct {
+	min, max time.Duration
+	current  int64 // atomic, time.Duration
+}
+
+// NewAdaptiveInterval creates an AdaptiveInterval that stays between
+// min and max. It starts at min. min must be positive and max must not
+// be less than min.
+func NewAdaptiveInterval(min, max time.Duration) *AdaptiveInterval {
+	if min <= 0 || max < min {
+		panic("invalid interval bounds")
+	}
+
+	return &AdaptiveInterval{
+		min:     min,
+		max:     max,
+		current: int64(min),
+	}
+}
+
+// Interval returns the current interval.
+func (a *AdaptiveInterval) Interval() time.Duration {
+	return time.Duration(atomic.LoadInt64(&a.current))
+}
+
+// observe records that the last send on the out channel
+// blocked for the given duration, and adjusts the interval.
+func (a *AdaptiveInterval) observe(blocked time.Duration) {
+	cur := a.Interval()
+	next := cur
+
+	if blocked > cur/4 {
+		next = cur * 2
+	} else if blocked == 0 {
+		next = cur - cur/8
+	}
+
+	if next > a.max {
+		next = a.max
+	} else if next < a.min {
+		next = a.min
+	}
+
+	// if other batchers are updating the interval at the same time,
+	// some of the updates will be lost, but that's fine
+	atomic.StoreInt64(&a.current, int64(next))
+}
@@ -0,0 +1,92 @@
+package batcher
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+func TestAdaptiveInterval(t *testing.T) {
+	tests := []struct {
+		name    string
+		blocked []time.Duration
+		want    time.Duration
+	}{
+		{
+			name: "initial",
+			want: 80 * time.Millisecond,
+		},
+		{
+			name:    "widen",
+			blocked: []time.Duration{time.Second},
+			want:    160 * time.Millisecond,
+		},
+		{
+			name: "widen to max",
+			blocked: []time.Duration{
+				time.Second, time.Second, time.Second, time.Second,
+			},
+			want: 500 * time.Millisecond,
+		},
+		{
+			name: "hold",
+			blocked: []time.Duration{
+				time.Second, 10 * time.Millisecond,
+			},
+			want: 160 * time.Millisecond,
+		},
+		{
+			name:    "narrow",
+			blocked: []time.Duration{time.Second, 0},
+			want:    140 * time.Millisecond,
+		},
+		{
+			name:    "narrow to min",
+			blocked: []time.Duration{0},
+			want:    80 * time.Millisecond,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := NewAdaptiveInterval(80*time.Millisecond, 500*time.Millisecond)
+			for _, b := range tt.blocked {
+				a.observe(b)
+			}
+			assert.Equal(t, tt.want, a.Interval())
+		})
+	}
+}
+
+func TestBatch_Adaptive(t *testing.T) {
+	in := make(chan int)
+	out := make(chan []int)
+	a := NewAdaptiveInterval(time.Millisecond, time.Second)
+
+	var wg sync.WaitGroup
+	Start(in, out, &wg, Params{
+		Threshold: 10,
+		Adaptive:  a,
+	})
+
+	go func() {
+		for i := 0; i < 50; i++ {
+			in <- i
+		}
+		close(in)
+	}()
+
+	// a slow receiver makes the batcher block on every send
+	n := 0
+	for batch := range out {
+		n += len(batch)
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	wg.Wait()
+	assert.Equal(t, 50, n)
+	assert.Greater(t, a.Interval(), time.Millisecond)
+	goleak.VerifyNone(t)
+}
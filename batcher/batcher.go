@@ -3,21 +3,64 @@
 // or a maximum interval elapses.
 // The batcher interacts with other code through two channels:
 // an input channel on which items are received, and an output
-// channel on which slices of items are sent.
+// channel on which slices of items are sent. Alternatively, batches
+// can be sent as Envelopes, which also describe how and when each
+// batch was built.
 //
 // Inspired by https://old.reddit.com/r/golang/comments/v9m37a
 // "Looking for examples of a "batch release threshold" pattern"
 package batcher
 
 import (
+	"context"
 	"sync"
 	"time"
+
+	"go.lepak.sg/playground/clock"
 )
 
 type Params struct {
 	Threshold int
 	Interval  time.Duration
 	Prealloc  bool
+
+	// Adaptive, if not nil, replaces Interval with an interval that
+	// adapts to how long sends on the out channel block.
+	// See AdaptiveInterval for details.
+	Adaptive *AdaptiveInterval
+
+	// Stats, if not nil, collects statistics about the batcher.
+	// Hooks are called when the batcher does certain things.
+	// See Stats and Hooks for details.
+	Stats *Stats
+	Hooks Hooks
+
+	// Clock is used to time batch intervals. If it is nil,
+	// the real clock is used. Pass a *clock.Fake in tests
+	// to control exactly when intervals elapse.
+	Clock clock.Clock
+
+	// DropOnCancel controls what happens to a partial batch
+	// when the context passed to BatchContext (or any of the other
+	// context-accepting functions) is canceled. If this is false,
+	// the partial batch is sent on the out channel before the
+	// batcher exits. If this is true, it is discarded.
+	DropOnCancel bool
+}
+
+// Weighted limits the total weight of the items in a batch, e.g. their
+// size in bytes once serialized. It is used by BatchWeighted and
+// StartWeighted.
+type Weighted[T any] struct {
+	// Weigh returns the weight of an item. It is called exactly
+	// once for each item.
+	Weigh func(T) int
+	// A batch is sent once the total weight of its items reaches
+	// MaxWeight. An item that would push the total weight of a partial
+	// batch past MaxWeight is held back, and the partial batch is sent
+	// without it. An item that weighs at least MaxWeight by itself
+	// is sent alone in its own batch.
+	MaxWeight int
 }
 
 // Start starts a batcher. Start increments wg for you, and the batcher
@@ -33,6 +76,16 @@ func Start[T any](
 	}()
 }
 
+// StartContext is like Start, but the batcher also exits when ctx
+// is canceled. The returned channel receives the error returned by
+// BatchContext once the batcher exits, and is then closed.
+func StartContext[T any](
+	ctx context.Context, in <-chan T, out chan<- []T, wg *sync.WaitGroup,
+	params Params,
+) <-chan error {
+	return start(ctx, in, out, items[T], batchExt[T]{}, wg, params).errc
+}
+
 // Batch batches up items from the in channel and sends the batches
 // on the out channel. It will build batches until either they reach
 // the threshold size or the interval has elapsed. Batch exits after
@@ -47,24 +100,250 @@ func Start[T any](
 func Batch[T any](
 	in <-chan T, out chan<- []T, params Params,
 ) {
-	batch(in, out, params, true)
+	BatchContext(context.Background(), in, out, params)
 }
 
-func batch[T any](
-	in <-chan T, out chan<- []T, params Params,
-	shouldClose bool,
-) {
-	var t *time.Timer
+// BatchContext is like Batch, but it also exits when ctx is canceled.
+// On cancellation, the partial batch (if any) is sent on out, unless
+// params.DropOnCancel is true, in which case it is discarded. Either way,
+// out is closed and the context error is returned. If in is closed
+// before ctx is canceled, BatchContext returns nil.
+//
+// Items that are still in the in channel when ctx is canceled are not
+// received by BatchContext. The send of the partial batch is not
+// affected by ctx, so the receiver should keep receiving from out
+// until it is closed.
+func BatchContext[T any](
+	ctx context.Context, in <-chan T, out chan<- []T, params Params,
+) error {
+	defer close(out)
+	return batch(ctx, in, out, items[T], nil, batchExt[T]{}, params)
+}
+
+// BatchWeighted is like BatchContext, but a batch is also sent once
+// the total weight of its items reaches weighted.MaxWeight. See Weighted
+// for details. Threshold and Interval still apply, so set Threshold to
+// a large value if batches should be limited by weight alone.
+// BatchWeighted panics if weighted.Weigh is nil or weighted.MaxWeight
+// is not positive.
+func BatchWeighted[T any](
+	ctx context.Context, in <-chan T, out chan<- []T, weighted Weighted[T],
+	params Params,
+) error {
+	weighted.check()
+	defer close(out)
+	return batch(ctx, in, out, items[T], nil,
+		batchExt[T]{weighted: weighted}, params)
+}
 
-	if shouldClose {
-		defer close(out)
+// StartWeighted is like StartContext, but it limits the weight of
+// each batch, like BatchWeighted.
+func StartWeighted[T any](
+	ctx context.Context, in <-chan T, out chan<- []T, wg *sync.WaitGroup,
+	weighted Weighted[T], params Params,
+) <-chan error {
+	weighted.check()
+	return start(ctx, in, out, items[T],
+		batchExt[T]{weighted: weighted}, wg, params).errc
+}
+
+func (w Weighted[T]) check() {
+	if w.Weigh == nil || w.MaxWeight <= 0 {
+		panic("invalid Weighted")
 	}
+}
+
+// batchExt holds optional behaviour of batch that is not configured
+// through Params, because it's only used by some kinds of batchers.
+type batchExt[T any] struct {
+	// co merges items into the partial batch where possible,
+	// instead of appending them, if it is not nil
+	co coalescer[T]
+	// wal logs every item received and every batch sent, and
+	// replays unacknowledged items, if it is not nil.
+	// It must not be used with co, since it acknowledges
+	// batches by their number of items
+	wal *WAL[T]
+	// weighted limits the weight of each batch,
+	// if its Weigh is not nil
+	weighted Weighted[T]
+	// canceled, if not nil, reports whether in was closed because
+	// the batcher that sends on it was canceled. If so, the partial
+	// batch is sent with FlushCanceled instead of FlushClosed
+	canceled func() bool
+}
+
+// items unwraps an Envelope into the slice of items
+// that is sent by the slice-based batchers.
+func items[T any](e Envelope[T]) []T {
+	return e.Items
+}
+
+// batch is the batching loop behind every batcher. Each batch is
+// wrapped by wrap and then sent on out. batch does not close out,
+// because it may not be the only one sending on it.
+//
+// When a flushReq is received from flush, the partial batch is sent
+// once the request's after items have been received, then its ack is
+// closed. flush may be nil.
+//
+// ext adds optional behaviour, see batchExt.
+func batch[T, E any](
+	ctx context.Context, in <-chan T, out chan<- E,
+	wrap func(Envelope[T]) E, flush <-chan flushReq, ext batchExt[T],
+	params Params,
+) error {
+	var t clock.Timer
+	co, wal := ext.co, ext.wal
+
+	clk := params.Clock
+	if clk == nil {
+		clk = clock.Real{}
+	}
+
+	// nil if ctx can never be canceled, so the select cases
+	// on done below are never chosen
+	done := ctx.Done()
+
+	weighted := ext.weighted.Weigh != nil
+	weigh, maxWeight := ext.weighted.Weigh, ext.weighted.MaxWeight
+
+	interval := func() time.Duration { return params.Interval }
+	if params.Adaptive != nil {
+		interval = params.Adaptive.Interval
+	}
+
+	// src is where items are received from. Items that the WAL
+	// replays are received first, then src becomes in
+	src := in
+	if wal != nil {
+		if pending := wal.replay(); len(pending) > 0 {
+			replay := make(chan T, len(pending))
+			for _, item := range pending {
+				replay <- item
+			}
+			close(replay)
+			src = replay
+		}
+	}
+
+	// flush requests that are waiting for items,
+	// and the number of items received so far
+	var pending []flushReq
+	var received uint64
+	defer func() {
+		// everything received has been sent or dropped
+		for _, req := range pending {
+			close(req.ack)
+		}
+	}()
+
+	// due returns true if a flush request has all its items
+	due := func() bool {
+		for _, req := range pending {
+			if received >= req.after {
+				return true
+			}
+		}
+		return false
+	}
+	// ackDue acknowledges the flush requests that have all
+	// their items, once they have been sent
+	ackDue := func() {
+		keep := pending[:0]
+		for _, req := range pending {
+			if received >= req.after {
+				close(req.ack)
+			} else {
+				keep = append(keep, req)
+			}
+		}
+		pending = keep
+	}
+
+	// receive handles an item received from src. It only fails if
+	// the item couldn't be written to the WAL
+	receive := func(item T) error {
+		received++
+		params.observeItem()
+		if wal != nil && src == in {
+			return wal.append(item)
+		}
+		return nil
+	}
+
+	// send only fails if the batch couldn't be acknowledged in the WAL
+	send := func(slice []T, first time.Time, reason FlushReason) error {
+		params.observeBatch(len(slice), reason)
+		e := wrap(Envelope[T]{
+			Items:   slice,
+			Reason:  reason,
+			First:   first,
+			Flushed: clk.Now(),
+		})
+
+		if params.Adaptive == nil {
+			out <- e
+		} else {
+			select {
+			case out <- e:
+				params.Adaptive.observe(0)
+			default:
+				start := clk.Now()
+				out <- e
+				params.Adaptive.observe(clk.Now().Sub(start))
+			}
+		}
+
+		if wal != nil {
+			return wal.ack(len(slice))
+		}
+		return nil
+	}
+
+	// an item that did not fit into the previous batch
+	// because of its weight, its weight, and when it arrived
+	var carry T
+	var carryWeight int
+	var carryTime time.Time
+	hasCarry := false
 
 	for {
-		// only proceed once there is at least one item
-		item, ok := <-in
-		if !ok {
-			return
+		var item T
+		var weight int
+		var first time.Time
+		if hasCarry {
+			item, weight, first = carry, carryWeight, carryTime
+			carry = *new(T) // don't keep it alive
+			hasCarry = false
+		} else {
+			// only proceed once there is at least one item
+			select {
+			case <-done:
+				return ctx.Err()
+			case req := <-flush:
+				// nothing to flush yet
+				pending = append(pending, req)
+				ackDue()
+				continue
+			case next, ok := <-src:
+				if !ok {
+					if src != in {
+						src = in
+						continue
+					}
+					return nil
+				}
+				item = next
+			}
+
+			if err := receive(item); err != nil {
+				return err
+			}
+			first = clk.Now()
+			if weighted {
+				weight = weigh(item)
+			}
 		}
 
 		var slice []T
@@ -74,45 +353,132 @@ func batch[T any](
 			slice = make([]T, 1)
 		}
 		slice[0] = item
+		if co != nil {
+			co.reset(item)
+		}
 
+		// send the batch right away if it's already complete
+		var reason FlushReason
+		immediate := true
 		if params.Threshold <= 1 {
-			out <- slice
+			reason = FlushThreshold
+		} else if weighted && weight >= maxWeight {
+			reason = FlushWeight
+		} else if due() {
+			reason = FlushManual
+		} else {
+			immediate = false
+		}
+		if immediate {
+			if err := send(slice, first, reason); err != nil {
+				return err
+			}
+			ackDue()
 			continue
 		}
 
 		// this is a one-shot timer, not a Ticker; it's easier to reason
 		// about, since we control its lifetime explicitly
 		if t == nil {
-			t = time.NewTimer(params.Interval)
+			t = clk.NewTimer(interval())
 		} else {
-			t.Reset(params.Interval)
+			t.Reset(interval())
 		}
 
+		reason = FlushInterval
 		running := true
 		for running {
 			select {
-			case <-t.C:
+			case <-t.C():
+				running = false
+
+			case req := <-flush:
+				pending = append(pending, req)
+				if !due() {
+					// wait for the items sent before the request
+					continue
+				}
+				if !t.Stop() {
+					<-t.C()
+				}
+				reason = FlushManual
 				running = false
 
-			case item, ok := <-in:
+			case <-done:
+				t.Stop()
+				if !params.DropOnCancel {
+					if err := send(slice, first, FlushCanceled); err != nil {
+						return err
+					}
+				}
+				return ctx.Err()
+
+			case item, ok := <-src:
 				if !ok {
-					out <- slice
+					if src != in {
+						src = in
+						continue
+					}
 					t.Stop()
-					// never using t again, don't care about draining t.C
-					return
+					// never using t again, don't care about draining t.C()
+					reason := FlushClosed
+					if ext.canceled != nil && ext.canceled() {
+						reason = FlushCanceled
+					}
+					return send(slice, first, reason)
 				}
 
-				slice = append(slice, item)
-				if len(slice) >= params.Threshold {
-					if !t.Stop() {
-						<-t.C
+				if err := receive(item); err != nil {
+					// the partial batch is in the WAL,
+					// so it will be replayed
+					t.Stop()
+					return err
+				}
+
+				if weighted {
+					w := weigh(item)
+					if weight+w > maxWeight {
+						// send this batch without the item,
+						// it goes into the next batch instead
+						carry, carryWeight, carryTime = item, w, clk.Now()
+						hasCarry = true
+						if !t.Stop() {
+							<-t.C()
+						}
+						reason = FlushWeight
+						running = false
+						break
 					}
-					running = false
+					weight += w
+				}
+
+				if co == nil || !co.merge(slice, item) {
+					slice = append(slice, item)
+				}
+				if len(slice) >= params.Threshold {
+					reason = FlushThreshold
+				} else if weighted && weight >= maxWeight {
+					reason = FlushWeight
+				} else if due() {
+					reason = FlushManual
+				} else {
+					continue
 				}
+
+				if !t.Stop() {
+					<-t.C()
+				}
+				running = false
 			}
 		}
 
-		out <- slice
+		if err := send(slice, first, reason); err != nil {
+			return err
+		}
+		if !hasCarry {
+			// otherwise the carried item must be sent first
+			ackDue()
+		}
 		// on the next iteration, slice will fall out of scope,
 		// which is exactly what we want
 	}
@@ -1,12 +1,15 @@
 package batcher
 
 import (
+	"context"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/stretchr/testify/assert"
 	"go.uber.org/goleak"
 
+	"go.lepak.sg/playground/clock"
 	"go.lepak.sg/playground/testutils"
 )
 
@@ -162,3 +165,189 @@ func TestBatch(t *testing.T) {
 		})
 	}
 }
+
+func TestBatchWeighted(t *testing.T) {
+	weigh := func(i int) int { return i }
+
+	tests := []struct {
+		name    string
+		items   []int
+		params  Params
+		drain   [][]int
+		reasons []FlushReason
+	}{
+		{
+			name:  "weight only",
+			items: []int{3, 4, 2, 5, 12, 1, 9},
+			params: Params{
+				Threshold: 100,
+				Interval:  time.Second,
+			},
+			drain: [][]int{
+				{3, 4, 2},
+				{5},
+				{12},
+				{1, 9},
+			},
+			reasons: []FlushReason{
+				FlushWeight, FlushWeight, FlushWeight, FlushWeight,
+			},
+		},
+		{
+			name:  "with threshold",
+			items: []int{1, 1, 1, 8, 1},
+			params: Params{
+				Threshold: 2,
+				Interval:  time.Second,
+			},
+			drain: [][]int{
+				{1, 1},
+				{1, 8},
+				{1},
+			},
+			reasons: []FlushReason{
+				FlushThreshold, FlushThreshold, FlushClosed,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			in := make(chan int, len(test.items))
+			out := make(chan []int, len(test.items))
+			for _, i := range test.items {
+				in <- i
+			}
+			close(in)
+
+			var reasons []FlushReason
+			test.params.Hooks.OnBatch = func(_ int, reason FlushReason) {
+				reasons = append(reasons, reason)
+			}
+
+			err := BatchWeighted(context.Background(), in, out,
+				Weighted[int]{Weigh: weigh, MaxWeight: 10}, test.params)
+			assert.NoError(t, err)
+			testutils.Drain(t, test.drain, out)
+			assert.Equal(t, test.reasons, reasons)
+		})
+	}
+
+	assert.PanicsWithValue(t, "invalid Weighted", func() {
+		BatchWeighted(context.Background(), nil, nil,
+			Weighted[int]{Weigh: weigh}, Params{})
+	})
+}
+
+func TestStartWeighted(t *testing.T) {
+	in := make(chan string)
+	out := make(chan []string, 2)
+
+	var wg sync.WaitGroup
+	errc := StartWeighted(context.Background(), in, out, &wg,
+		Weighted[string]{
+			Weigh:     func(s string) int { return len(s) },
+			MaxWeight: 10,
+		},
+		Params{
+			Threshold: 10,
+			Interval:  time.Hour,
+		})
+
+	in <- "apple"
+	in <- "banana"
+	in <- "kiwi"
+	close(in)
+
+	wg.Wait()
+	assert.NoError(t, <-errc)
+	testutils.Drain(t, [][]string{{"apple"}, {"banana", "kiwi"}}, out)
+	goleak.VerifyNone(t)
+}
+
+func TestBatchContext(t *testing.T) {
+	tests := []struct {
+		name    string
+		cancel  bool
+		drop    bool
+		drain   [][]int
+		wantErr error
+	}{
+		{
+			name:  "in closed",
+			drain: [][]int{{0, 1, 2}, {3, 4}},
+		},
+		{
+			name:    "cancel flush",
+			cancel:  true,
+			drain:   [][]int{{0, 1, 2}, {3, 4}},
+			wantErr: context.Canceled,
+		},
+		{
+			name:    "cancel drop",
+			cancel:  true,
+			drop:    true,
+			drain:   [][]int{{0, 1, 2}},
+			wantErr: context.Canceled,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			in := make(chan int)
+			out := make(chan []int, 2)
+
+			var wg sync.WaitGroup
+			errc := StartContext(ctx, in, out, &wg, Params{
+				Threshold:    3,
+				Interval:     time.Hour,
+				DropOnCancel: test.drop,
+			})
+
+			for i := 0; i < 5; i++ {
+				in <- i
+			}
+
+			if test.cancel {
+				cancel()
+			} else {
+				close(in)
+			}
+
+			wg.Wait()
+			assert.ErrorIs(t, <-errc, test.wantErr)
+			testutils.Drain(t, test.drain, out)
+			goleak.VerifyNone(t)
+		})
+	}
+}
+
+func TestBatch_FakeClock(t *testing.T) {
+	in := make(chan int)
+	out := make(chan []int, 2)
+	clk := clock.NewFake(time.Unix(0, 0))
+
+	var wg sync.WaitGroup
+	Start(in, out, &wg, Params{
+		Threshold: 10,
+		Interval:  time.Second,
+		Clock:     clk,
+	})
+
+	in <- 1
+	in <- 2
+	clk.WaitTimers(1)
+	clk.Advance(time.Second - 1)
+	assert.Len(t, out, 0)
+	clk.Advance(1)
+	assert.Equal(t, []int{1, 2}, <-out)
+
+	in <- 3
+	close(in)
+	wg.Wait()
+	testutils.Drain(t, [][]int{{3}}, out)
+	goleak.VerifyNone(t)
+}
@@ -0,0 +1,85 @@
+package batcher
+
+import (
+	"context"
+	"sync"
+)
+
+// coalescer merges items with the same key in a partial batch.
+type coalescer[T any] interface {
+	// reset forgets the previous batch, which is replaced
+	// by a new batch that contains only first.
+	reset(first T)
+	// merge merges item into the item with the same key in slice,
+	// if there is one, and reports whether it did. Otherwise, the
+	// caller must append item to slice.
+	merge(slice []T, item T) bool
+}
+
+type keyCoalescer[T any, K comparable] struct {
+	key   func(T) K
+	fn    func(old, new T) T
+	index map[K]int // key -> index in the partial batch
+}
+
+func newKeyCoalescer[T any, K comparable](
+	key func(T) K, merge func(old, new T) T,
+) coalescer[T] {
+	return &keyCoalescer[T, K]{
+		key:   key,
+		fn:    merge,
+		index: make(map[K]int),
+	}
+}
+
+func (c *keyCoalescer[T, K]) reset(first T) {
+	for k := range c.index {
+		delete(c.index, k)
+	}
+	c.index[c.key(first)] = 0
+}
+
+func (c *keyCoalescer[T, K]) merge(slice []T, item T) bool {
+	k := c.key(item)
+	if i, ok := c.index[k]; ok {
+		slice[i] = c.fn(slice[i], item)
+		return true
+	}
+	c.index[k] = len(slice)
+	return false
+}
+
+// KeepLast is a merge function for BatchCoalesce and NewCoalesce
+// that keeps only the newest item for each key.
+func KeepLast[T any](_, new T) T {
+	return new
+}
+
+// BatchCoalesce is like BatchContext, but items with the same key
+// are combined while they are in the same partial batch. When an item
+// is received and the partial batch already has an item with the same
+// key, the two are replaced by merge(old, new), which stays in the
+// place of the old item. So each batch has at most one item per key,
+// in the order that the keys were first seen in the batch. Items in
+// different batches are never merged.
+//
+// Threshold limits the number of distinct keys in a batch, not the
+// number of items received.
+func BatchCoalesce[T any, K comparable](
+	ctx context.Context, in <-chan T, out chan<- []T, key func(T) K,
+	merge func(old, new T) T, params Params,
+) error {
+	defer close(out)
+	return batch(ctx, in, out, items[T], nil,
+		batchExt[T]{co: newKeyCoalescer(key, merge)}, params)
+}
+
+// NewCoalesce starts a coalescing batcher, like BatchCoalesce,
+// and returns its Handle.
+func NewCoalesce[T any, K comparable](
+	ctx context.Context, in <-chan T, out chan<- []T, key func(T) K,
+	merge func(old, new T) T, wg *sync.WaitGroup, params Params,
+) *Handle {
+	return start(ctx, in, out, items[T],
+		batchExt[T]{co: newKeyCoalescer(key, merge)}, wg, params)
+}
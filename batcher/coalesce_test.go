@@ -0,0 +1,104 @@
+package batcher
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+
+	"go.lepak.sg/playground/testutils"
+)
+
+func TestBatchCoalesce(t *testing.T) {
+	join := func(old, new string) string {
+		return old + "+" + new
+	}
+
+	tests := []struct {
+		name   string
+		items  []string
+		merge  func(old, new string) string
+		params Params
+		drain  [][]string
+	}{
+		{
+			name:  "keep last",
+			items: []string{"apple", "banana", "apricot", "cherry", "avocado"},
+			merge: KeepLast[string],
+			params: Params{
+				Threshold: 10,
+				Interval:  time.Hour,
+			},
+			drain: [][]string{{"avocado", "banana", "cherry"}},
+		},
+		{
+			name: "merge",
+			items: []string{"apple", "banana", "apricot", "cherry",
+				"blueberry", "avocado"},
+			merge: join,
+			params: Params{
+				Threshold: 10,
+				Interval:  time.Hour,
+			},
+			drain: [][]string{
+				{"apple+apricot+avocado", "banana+blueberry", "cherry"},
+			},
+		},
+		{
+			name: "threshold counts keys",
+			items: []string{"apple", "apricot", "banana", "blueberry",
+				"cherry"},
+			merge: join,
+			params: Params{
+				Threshold: 2,
+				Interval:  time.Hour,
+			},
+			drain: [][]string{
+				{"apple+apricot", "banana"},
+				{"blueberry", "cherry"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := make(chan string, len(tt.items))
+			out := make(chan []string, len(tt.items))
+			for _, item := range tt.items {
+				in <- item
+			}
+			close(in)
+
+			err := BatchCoalesce(context.Background(), in, out, stringKeyer,
+				tt.merge, tt.params)
+			assert.NoError(t, err)
+			testutils.Drain(t, tt.drain, out)
+		})
+	}
+}
+
+func TestNewCoalesce(t *testing.T) {
+	in := make(chan string)
+	out := make(chan []string, 2)
+
+	var wg sync.WaitGroup
+	h := NewCoalesce(context.Background(), in, out, stringKeyer,
+		KeepLast[string], &wg, Params{
+			Threshold: 10,
+			Interval:  time.Hour,
+		})
+
+	in <- "apple"
+	in <- "apricot"
+	assert.NoError(t, h.Flush(context.Background()))
+	// the next batch doesn't merge with the flushed one
+	in <- "avocado"
+	close(in)
+
+	wg.Wait()
+	assert.NoError(t, h.Wait())
+	testutils.Drain(t, [][]string{{"apricot"}, {"avocado"}}, out)
+	goleak.VerifyNone(t)
+}
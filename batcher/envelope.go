@@ -0,0 +1,91 @@
+package batcher
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// FlushReason is the reason why a batch was sent.
+type FlushReason int
+
+const (
+	// The batch reached Params.Threshold items.
+	FlushThreshold FlushReason = iota
+	// The batch reached Weighted.MaxWeight, or the next item
+	// would have taken it past MaxWeight.
+	FlushWeight
+	// The batch interval elapsed.
+	FlushInterval
+	// The input channel was closed.
+	FlushClosed
+	// The context was canceled.
+	FlushCanceled
+	// Handle.Flush was called.
+	FlushManual
+)
+
+func (r FlushReason) String() string {
+	switch r {
+	case FlushThreshold:
+		return "Threshold"
+	case FlushWeight:
+		return "Weight"
+	case FlushInterval:
+		return "Interval"
+	case FlushClosed:
+		return "Closed"
+	case FlushCanceled:
+		return "Canceled"
+	case FlushManual:
+		return "Manual"
+	default:
+		return "<invalid batcher.FlushReason>"
+	}
+}
+
+// Envelope is a batch of items, together with some information
+// about how it was built. It is sent by BatchEnvelopes and
+// StartEnvelopes instead of a plain slice of items.
+type Envelope[T any] struct {
+	Items  []T
+	Reason FlushReason
+	// First is the time when the first item in the batch
+	// was received.
+	First time.Time
+	// Flushed is the time when the batch was sent.
+	Flushed time.Time
+}
+
+// GroupedEnvelope is an Envelope that also carries the key of the
+// group its items belong to. It is sent by StartGroupedEnvelopes.
+type GroupedEnvelope[T any, K comparable] struct {
+	Envelope[T]
+	Key K
+	// Overflow is true if the batch was sent by the overflow
+	// sub-batcher (see GroupLimitOverflow). Its items may have
+	// different keys, and Key is the zero value.
+	Overflow bool
+}
+
+// BatchEnvelopes is like BatchContext, but it sends each batch
+// wrapped in an Envelope.
+func BatchEnvelopes[T any](
+	ctx context.Context, in <-chan T, out chan<- Envelope[T], params Params,
+) error {
+	defer close(out)
+	return batch(ctx, in, out, envelope[T], nil, batchExt[T]{}, params)
+}
+
+func envelope[T any](e Envelope[T]) Envelope[T] {
+	return e
+}
+
+// StartEnvelopes is like StartContext, but it sends each batch
+// wrapped in an Envelope.
+func StartEnvelopes[T any](
+	ctx context.Context, in <-chan T, out chan<- Envelope[T],
+	wg *sync.WaitGroup, params Params,
+) <-chan error {
+	return start(ctx, in, out, envelope[T], batchExt[T]{}, wg, params).errc
+}
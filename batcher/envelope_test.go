@@ -0,0 +1,133 @@
+package batcher
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+func TestBatchEnvelopes(t *testing.T) {
+	in := make(chan int)
+	out := make(chan Envelope[int], 10)
+
+	var wg sync.WaitGroup
+	errc := StartEnvelopes(context.Background(), in, out, &wg, Params{
+		Threshold: 3,
+		Interval:  100 * time.Millisecond,
+	})
+
+	start := time.Now()
+	for _, i := range []int{1, 2, 3, 4} {
+		in <- i
+	}
+	time.Sleep(200 * time.Millisecond)
+	for _, i := range []int{5} {
+		in <- i
+	}
+	close(in)
+
+	wg.Wait()
+	assert.NoError(t, <-errc)
+
+	want := []struct {
+		items  []int
+		reason FlushReason
+	}{
+		{[]int{1, 2, 3}, FlushThreshold},
+		{[]int{4}, FlushInterval},
+		{[]int{5}, FlushClosed},
+	}
+
+	var got []Envelope[int]
+	for e := range out {
+		got = append(got, e)
+	}
+
+	if assert.Len(t, got, len(want)) {
+		for i, w := range want {
+			assert.Equal(t, w.items, got[i].Items)
+			assert.Equal(t, w.reason, got[i].Reason, "reason of batch %d", i)
+			assert.False(t, got[i].First.Before(start))
+			assert.False(t, got[i].Flushed.Before(got[i].First))
+		}
+	}
+
+	assert.GreaterOrEqual(t,
+		got[1].Flushed.Sub(got[1].First), 100*time.Millisecond)
+	goleak.VerifyNone(t)
+}
+
+func TestStartGroupedEnvelopes(t *testing.T) {
+	in := make(chan string, 4)
+	out := make(chan GroupedEnvelope[string, char], 4)
+
+	in <- "apple"
+	in <- "banana"
+	in <- "apricot"
+	in <- "blueberry"
+	close(in)
+
+	var wg sync.WaitGroup
+	errc := StartGroupedEnvelopes(context.Background(), in, out, stringKeyer,
+		&wg, GroupedParams{
+			Params: Params{
+				Threshold: 2,
+				Interval:  time.Second,
+			},
+		})
+
+	wg.Wait()
+	assert.NoError(t, <-errc)
+
+	got := make(map[char][]string)
+	for e := range out {
+		assert.Equal(t, FlushThreshold, e.Reason)
+		got[e.Key] = e.Items
+	}
+
+	assert.Equal(t, map[char][]string{
+		'a': {"apple", "apricot"},
+		'b': {"banana", "blueberry"},
+	}, got)
+	goleak.VerifyNone(t)
+}
+
+func TestStartGroupedEnvelopes_Canceled(t *testing.T) {
+	in := make(chan string)
+	out := make(chan GroupedEnvelope[string, char], 4)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var wg sync.WaitGroup
+	errc := StartGroupedEnvelopes(ctx, in, out, stringKeyer, &wg,
+		GroupedParams{
+			Params: Params{
+				Threshold: 10,
+				Interval:  time.Hour,
+			},
+			MaxGroups:        1,
+			GroupLimitPolicy: GroupLimitOverflow,
+		})
+
+	in <- "apple"
+	in <- "banana"
+	in <- "apricot"
+	cancel()
+
+	wg.Wait()
+	assert.ErrorIs(t, <-errc, context.Canceled)
+
+	got := make(map[bool][]string)
+	for e := range out {
+		assert.Equal(t, FlushCanceled, e.Reason)
+		got[e.Overflow] = e.Items
+	}
+	assert.Equal(t, map[bool][]string{
+		false: {"apple", "apricot"},
+		true:  {"banana"},
+	}, got)
+	goleak.VerifyNone(t)
+}
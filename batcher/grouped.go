@@ -1,12 +1,16 @@
 package batcher
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"runtime"
 	"sync"
 	"sync/atomic"
+	"time"
 
+	"go.lepak.sg/playground/clock"
+	"go.lepak.sg/playground/lmap"
 	"go.lepak.sg/playground/slidingwindow"
 )
 
@@ -42,10 +46,30 @@ type GroupedParams struct {
 	// the key 'A', the sub-batcher for 'A' is stopped.
 	//
 	// If this is 0, sub-batchers will be kept alive
-	// forever. If the key cardinality is high,
-	// this may cause high memory usage.
+	// forever (unless IdleTimeout is set). If the key
+	// cardinality is high, this may cause high memory usage.
 	Lifetime int
 
+	// IdleTimeout is how long a sub-batcher may go without
+	// receiving an item before it is stopped. Unlike Lifetime,
+	// this works even when few items are received for any key.
+	// The time is measured with Params.Clock.
+	//
+	// If this is 0, sub-batchers are only stopped according
+	// to Lifetime. Both may be set, in which case a sub-batcher
+	// is stopped by whichever is reached first.
+	IdleTimeout time.Duration
+
+	// MaxGroups is the maximum number of sub-batchers that may
+	// be running at once. When an item with a new key is received
+	// and there are already MaxGroups sub-batchers, what happens
+	// next depends on GroupLimitPolicy.
+	// The number of running sub-batchers is reported by Handle.Groups.
+	//
+	// If this is 0, there is no limit.
+	MaxGroups        int
+	GroupLimitPolicy GroupLimitPolicy
+
 	// KeyCardinalityHint is a hint of the key cardinality,
 	// i.e. the number of distinct values of the key.
 	// This is used for performance reasons; see the
@@ -55,6 +79,54 @@ type GroupedParams struct {
 	KeyCardinalityHint int
 }
 
+// GroupedOption changes how a grouping batcher with keys of type K
+// works. Options can be passed to any function that starts a grouping
+// batcher.
+type GroupedOption[K comparable] func(*groupedOptions[K])
+
+type groupedOptions[K comparable] struct {
+	paramsFor func(K) Params
+}
+
+// WithKeyParams lets each sub-batcher batch items differently. When
+// a sub-batcher is created for a key, paramsFor is called with the key,
+// and the sub-batcher uses the Threshold, Interval, Prealloc and
+// Adaptive fields of the returned Params. The other fields, such as
+// Stats and Clock, are always taken from GroupedParams.Params. The
+// overflow sub-batcher, which has no key, uses GroupedParams.Params.
+//
+// paramsFor is called from the goroutine that receives from in, so a
+// slow paramsFor slows down the whole grouping batcher. For a sharded
+// grouping batcher, it is called from each shard's goroutine.
+func WithKeyParams[K comparable](paramsFor func(K) Params) GroupedOption[K] {
+	return func(o *groupedOptions[K]) {
+		o.paramsFor = paramsFor
+	}
+}
+
+// GroupLimitPolicy decides what happens when a grouping batcher
+// receives an item with a new key, but it already has
+// GroupedParams.MaxGroups sub-batchers running.
+type GroupLimitPolicy int
+
+const (
+	// The grouping batcher stops receiving items until an idle
+	// sub-batcher is stopped, then it creates a sub-batcher for the
+	// new key. This requires GroupedParams.IdleTimeout to be set.
+	// If the context is canceled while waiting, the item is sent in
+	// a batch by itself, or dropped if Params.DropOnCancel is true.
+	GroupLimitBlock GroupLimitPolicy = iota
+	// The least recently used sub-batcher is stopped, sending its
+	// partial batch, to make room for a sub-batcher for the new key.
+	GroupLimitEvictLRU
+	// The item is sent to a shared overflow sub-batcher instead.
+	// Batches from the overflow sub-batcher may contain items with
+	// different keys. Items with the same key are still sent in
+	// order: before a sub-batcher is created for a key that was sent
+	// to the overflow sub-batcher, the overflow sub-batcher is flushed.
+	GroupLimitOverflow
+)
+
 type window[K comparable] interface {
 	Observe(K)
 	Lifetime() int
@@ -72,24 +144,56 @@ const (
 )
 
 type sub[T any, K comparable] struct {
-	key K
-	ch  chan T         // to sub-batcher
-	wg  sync.WaitGroup // sub-batcher decrements this
-	// running -> closing when evicted from window
+	key   K
+	ch    chan T        // to sub-batcher
+	flush chan flushReq // to sub-batcher
+	// the number of items sent on ch, only accessed by accept
+	sent uint64
+	wg   sync.WaitGroup // sub-batcher decrements this
+	// running -> closing when evicted from window, or idle
 	// closing -> deleted when removed from active map
 	state uint64
+	// when the last item was sent to the sub-batcher,
+	// only accessed by accept
+	lastSeen time.Time
+	// true for the overflow sub-batcher, which has no key
+	overflow bool
+	// the sub-batcher's own params
+	params Params
+	// set by accept before it closes ch, if it was canceled,
+	// so the sub-batcher reports FlushCanceled
+	canceled bool
 }
 
-type grouped[T any, K comparable] struct {
+type grouped[T any, K comparable, E any] struct {
 	active map[K]*sub[T, K]
 
+	// ctx stops accept early. subCtx is passed to sub-batchers:
+	// it is ctx if partial batches are dropped on cancellation,
+	// otherwise it is never canceled, so that sub-batchers flush
+	// everything that accept has already handed to them
+	ctx    context.Context
+	subCtx context.Context
+	// accept serves flush requests from h, and once all sub-batchers
+	// have exited, calls exit with its result. exit closes out and
+	// calls h.exit, unless this is one shard of a sharded batcher
+	h    *Handle
+	exit func(err error)
+	// flush requests that are waiting for items, and the number of
+	// items received from in so far. Only a sharded batcher sends
+	// requests that have to wait, see flushReq
+	pendingFlush []flushReq
+	received     uint64
+
 	// window records uses of sub-batchers
 	// so that inactive ones can be stopped
 	// if lifetime = 0, this is a dummy
 	window window[*sub[T, K]]
 
 	in  <-chan T
-	out chan<- []T
+	out chan<- E
+	// wraps batches from sub-batchers before they are sent on out
+	wrap func(e Envelope[T], key K, overflow bool) E
 
 	// incremented by StartGrouped
 	// and decremented when accept/cleanup exit
@@ -97,14 +201,43 @@ type grouped[T any, K comparable] struct {
 
 	subParams Params
 	subChCap  int
+	// if not nil, paramsFor chooses the batching params of
+	// each new sub-batcher
+	paramsFor func(K) Params
 
 	keyer func(T) K
 
-	// evictq connects the window and the cleanup goroutine
-	// if lifetime = 0, since window does nothing,
-	// evictq will be nil
+	// evictq connects the window and the idle timer
+	// to the cleanup goroutine
+	// if lifetime = 0 and idleTimeout = 0, since nothing
+	// is ever evicted, evictq will be nil
 	evictq chan *sub[T, K]
 
+	clock       clock.Clock
+	idleTimeout time.Duration
+	// idleTimer expires when the sub-batcher that was idle for
+	// the longest time may have been idle for idleTimeout
+	// it's only used by accept, and nil until the first sub-batcher
+	// is created
+	idleTimer   clock.Timer
+	idleC       <-chan time.Time
+	idleRunning bool
+
+	// live is the number of running sub-batchers, excluding overflow
+	// only used by accept, which copies it to h.groups
+	live        int
+	maxGroups   int
+	groupPolicy GroupLimitPolicy
+	// lru orders running sub-batchers by their last use,
+	// nil unless groupPolicy is GroupLimitEvictLRU
+	lru *lmap.LinkedMap[K, *sub[T, K]]
+	// overflow receives items with new keys when there are
+	// already maxGroups sub-batchers, and overflowed is the set
+	// of keys sent to it since it was last flushed
+	// only used with GroupLimitOverflow, and only by accept
+	overflow   *sub[T, K]
+	overflowed map[K]struct{}
+
 	debug io.Writer
 
 	maplock sync.Mutex // protects active
@@ -113,18 +246,62 @@ type grouped[T any, K comparable] struct {
 	subWg sync.WaitGroup
 }
 
-func (m *grouped[T, K]) accept() {
-	for item := range m.in {
-		m.acceptOne(item)
+func (m *grouped[T, K, E]) accept() {
+	var err error
+	done := m.ctx.Done()
+
+loop:
+	for {
+		select {
+		case <-done:
+			err = m.ctx.Err()
+			break loop
+		case req := <-m.h.flush:
+			m.pendingFlush = append(m.pendingFlush, req)
+			m.flushDue()
+		case <-m.idleC:
+			m.idleRunning = false
+			m.evictIdle()
+		case item, ok := <-m.in:
+			if !ok {
+				break loop
+			}
+			m.acceptOne(item)
+			m.received++
+			if len(m.pendingFlush) > 0 {
+				m.flushDue()
+			}
+		}
+	}
+
+	if m.idleTimer != nil {
+		m.idleTimer.Stop()
 	}
 
 	// shutdown sub-batchers in any order
+	// evicted sub-batchers may still be in the map, waiting for
+	// cleanup, but their channels are already closed
+	// a shard's in is closed when the sharded batcher is canceled,
+	// so it may see that before ctx is canceled
+	canceled := err != nil || m.ctx.Err() != nil
+
+	m.maplock.Lock()
 	for _, dest := range m.active {
-		close(dest.ch)
+		if atomic.LoadUint64(&dest.state) == stateRunning {
+			dest.canceled = canceled
+			close(dest.ch)
+		}
 	}
+	m.maplock.Unlock()
+	if m.overflow != nil {
+		m.overflow.canceled = canceled
+		close(m.overflow.ch)
+	}
+	m.subParams.observeGroupsStopped(m.live)
+	m.setLive(0)
 
 	// shutdown cleanup
-	// if lifetime = 0, evictq is nil, and
+	// if lifetime = 0 and idleTimeout = 0, evictq is nil, and
 	// cleanup was never started
 	if m.evictq != nil {
 		close(m.evictq)
@@ -133,13 +310,17 @@ func (m *grouped[T, K]) accept() {
 	// once all sub-batchers have exited,
 	// close m.out on their behalf
 	m.subWg.Wait()
-	close(m.out)
+	// everything received has been sent or dropped
+	for _, req := range m.pendingFlush {
+		close(req.ack)
+	}
+	m.exit(err)
 
 	// cleanup will decrement m.wg as well
 	m.wg.Done()
 }
 
-func (m *grouped[T, K]) acceptOne(item T) {
+func (m *grouped[T, K, E]) acceptOne(item T) {
 	key := m.keyer(item)
 	// later on, if this is not nil,
 	// we have to wait for this sub-batcher
@@ -158,18 +339,41 @@ func (m *grouped[T, K]) acceptOne(item T) {
 	}
 
 	if !ok {
+		if m.maxGroups > 0 && m.live >= m.maxGroups {
+			switch m.groupPolicy {
+			case GroupLimitBlock:
+				if !m.waitForRoom() {
+					// there is still no room, and there won't be
+					m.sendAlone(key, item, oldRec)
+					return
+				}
+			case GroupLimitEvictLRU:
+				_, lru, _ := m.lru.Head(false)
+				m.enqueueForCleanup(lru)
+			case GroupLimitOverflow:
+				if oldRec != nil {
+					// the stopped sub-batcher for this key may not
+					// have sent its last batch yet
+					oldRec.wg.Wait()
+				}
+				m.sendOverflow(key, item)
+				return
+			}
+		}
+
+		if _, ok := m.overflowed[key]; ok {
+			// earlier items with this key must be sent first
+			m.flushOverflow()
+		}
+
 		if m.debug != nil {
 			fmt.Fprintf(m.debug, "create: key=%v lifetime=%d\n",
 				key, m.window.Lifetime())
 		}
 
-		subRec = &sub[T, K]{
-			key: key,
-			ch:  make(chan T, m.subChCap),
-		}
-		subRec.wg.Add(1)
-		m.subWg.Add(1)
-		go m.runSub(subRec)
+		subRec = m.newSub(key, false)
+		m.setLive(m.live + 1)
+		m.subParams.observeGroupCreated()
 
 		// spinwait if needed
 		if oldRec != nil {
@@ -188,22 +392,272 @@ func (m *grouped[T, K]) acceptOne(item T) {
 		m.maplock.Lock()
 		m.active[key] = subRec
 		m.maplock.Unlock()
+
+		if m.idleTimeout > 0 && !m.idleRunning {
+			m.startIdleTimer(m.idleTimeout)
+		}
+	}
+
+	if m.idleTimeout > 0 {
+		subRec.lastSeen = m.clock.Now()
+	}
+	if m.lru != nil {
+		m.lru.Set(key, subRec, true)
 	}
 
-	subRec.ch <- item
+	select {
+	case subRec.ch <- item:
+		subRec.sent++
+	case <-m.subCtx.Done():
+		// the sub-batcher may have exited already, so the item
+		// can't be delivered; it would have been dropped anyway
+		return
+	}
 	// will trigger eviction via enqueueForCleanup if needed
 	m.window.Observe(subRec)
 }
 
-func (m *grouped[T, K]) runSub(subRec *sub[T, K]) {
+func (m *grouped[T, K, E]) newSub(key K, overflow bool) *sub[T, K] {
+	subRec := &sub[T, K]{
+		key:      key,
+		ch:       make(chan T, m.subChCap),
+		flush:    make(chan flushReq),
+		overflow: overflow,
+		params:   m.subParams,
+	}
+	if m.paramsFor != nil && !overflow {
+		// only the batching params differ between keys,
+		// everything else describes the grouping batcher as a whole
+		p := m.paramsFor(key)
+		subRec.params.Threshold = p.Threshold
+		subRec.params.Interval = p.Interval
+		subRec.params.Prealloc = p.Prealloc
+		subRec.params.Adaptive = p.Adaptive
+	}
+	subRec.wg.Add(1)
+	m.subWg.Add(1)
+	go m.runSub(subRec)
+	return subRec
+}
+
+func (m *grouped[T, K, E]) setLive(n int) {
+	m.live = n
+	atomic.StoreInt64(&m.h.groups, int64(n))
+}
+
+// waitForRoom blocks until there are less than maxGroups sub-batchers
+// running, while still stopping idle sub-batchers and serving flushes.
+// It returns false if ctx was canceled first.
+func (m *grouped[T, K, E]) waitForRoom() bool {
+	done := m.ctx.Done()
+
+	for m.live >= m.maxGroups {
+		select {
+		case <-done:
+			return false
+		case req := <-m.h.flush:
+			// the item waiting for room isn't counted yet,
+			// so a request that waits for it stays pending
+			m.pendingFlush = append(m.pendingFlush, req)
+			m.flushDue()
+		case <-m.idleC:
+			m.idleRunning = false
+			m.evictIdle()
+		}
+	}
+
+	return true
+}
+
+// sendAlone sends item in a batch by itself, without creating
+// a sub-batcher, when ctx was canceled while waiting for room
+// for one. The item is dropped if sub-batchers drop theirs.
+func (m *grouped[T, K, E]) sendAlone(key K, item T, oldRec *sub[T, K]) {
+	if m.subCtx.Err() != nil {
+		return
+	}
+	if oldRec != nil {
+		// the stopped sub-batcher for this key may not
+		// have sent its last batch yet
+		oldRec.wg.Wait()
+	}
+
+	m.subParams.observeItem()
+	m.subParams.observeBatch(1, FlushCanceled)
+	now := m.clock.Now()
+	m.out <- m.wrap(Envelope[T]{
+		Items:   []T{item},
+		Reason:  FlushCanceled,
+		First:   now,
+		Flushed: now,
+	}, key, false)
+}
+
+func (m *grouped[T, K, E]) sendOverflow(key K, item T) {
+	if m.overflow == nil {
+		var noKey K
+		m.overflow = m.newSub(noKey, true)
+		m.overflowed = make(map[K]struct{})
+	}
+
+	m.overflowed[key] = struct{}{}
+
+	select {
+	case m.overflow.ch <- item:
+		m.overflow.sent++
+	case <-m.subCtx.Done():
+	}
+}
+
+// flushOverflow flushes the overflow sub-batcher, after which
+// it no longer has items with any key.
+func (m *grouped[T, K, E]) flushOverflow() {
+	ack := m.requestFlush(m.overflow)
+	if ack == nil {
+		return
+	}
+
+	select {
+	case <-ack:
+		m.overflowed = make(map[K]struct{})
+	case <-m.subCtx.Done():
+	}
+}
+
+func (m *grouped[T, K, E]) startIdleTimer(d time.Duration) {
+	if m.idleTimer == nil {
+		m.idleTimer = m.clock.NewTimer(d)
+		m.idleC = m.idleTimer.C()
+	} else {
+		// only called after the timer has expired,
+		// and its channel was drained
+		m.idleTimer.Reset(d)
+	}
+	m.idleRunning = true
+}
+
+// evictIdle stops sub-batchers that have been idle for at least
+// idleTimeout, then restarts the idle timer if there are any left.
+// It runs in accept, like the window's Observe.
+func (m *grouped[T, K, E]) evictIdle() {
+	now := m.clock.Now()
+	var idle []*sub[T, K]
+	var oldest time.Time
+
+	m.maplock.Lock()
+	for _, subRec := range m.active {
+		if atomic.LoadUint64(&subRec.state) != stateRunning {
+			continue
+		}
+
+		if now.Sub(subRec.lastSeen) >= m.idleTimeout {
+			idle = append(idle, subRec)
+		} else if oldest.IsZero() || subRec.lastSeen.Before(oldest) {
+			oldest = subRec.lastSeen
+		}
+	}
+	m.maplock.Unlock()
+
+	// can't hold maplock here, because cleanup
+	// needs it to drain evictq
+	for _, subRec := range idle {
+		m.enqueueForCleanup(subRec)
+	}
+
+	if !oldest.IsZero() {
+		m.startIdleTimer(oldest.Add(m.idleTimeout).Sub(now))
+	}
+}
+
+func (m *grouped[T, K, E]) runSub(subRec *sub[T, K]) {
 	defer subRec.wg.Done()
 	defer m.subWg.Done()
-	// shouldClose = false, because it is not
-	// the only one sending on m.out
-	batch(subRec.ch, m.out, m.subParams, false)
+	// batch doesn't close m.out, because
+	// this is not the only one sending on it
+	batch(m.subCtx, subRec.ch, m.out, func(e Envelope[T]) E {
+		return m.wrap(e, subRec.key, subRec.overflow)
+	}, subRec.flush, batchExt[T]{
+		// closing ch happens before the sub-batcher sees it closed
+		canceled: func() bool { return subRec.canceled },
+	}, subRec.params)
 }
 
-func (m *grouped[T, K]) enqueueForCleanup(rec *sub[T, K]) {
+// flushDue flushes every sub-batcher if any pending flush request
+// has all its items, then acknowledges those requests.
+func (m *grouped[T, K, E]) flushDue() {
+	keep := m.pendingFlush[:0]
+	flushed := false
+	for _, req := range m.pendingFlush {
+		if m.received < req.after {
+			keep = append(keep, req)
+			continue
+		}
+		if !flushed {
+			m.flushAll()
+			flushed = true
+		}
+		close(req.ack)
+	}
+	m.pendingFlush = keep
+}
+
+// flushAll flushes every sub-batcher and returns once they have
+// sent their partial batches. It runs in accept, so no items are
+// sent to sub-batchers and no sub-batchers are created meanwhile.
+func (m *grouped[T, K, E]) flushAll() {
+	m.maplock.Lock()
+	subs := make([]*sub[T, K], 0, len(m.active)+1)
+	for _, subRec := range m.active {
+		subs = append(subs, subRec)
+	}
+	m.maplock.Unlock()
+
+	if m.overflow != nil {
+		subs = append(subs, m.overflow)
+	}
+
+	done := m.subCtx.Done()
+	acks := make([]chan struct{}, 0, len(subs))
+
+	for _, subRec := range subs {
+		if atomic.LoadUint64(&subRec.state) != stateRunning {
+			// evicted, so its channel is closed, and it will
+			// send everything it has before exiting
+			subRec.wg.Wait()
+			continue
+		}
+
+		ack := m.requestFlush(subRec)
+		if ack == nil {
+			return
+		}
+		acks = append(acks, ack)
+	}
+
+	for _, ack := range acks {
+		select {
+		case <-ack:
+		case <-done:
+			return
+		}
+	}
+}
+
+// requestFlush asks a running sub-batcher to flush, and returns the
+// channel that it closes once it's done. The sub-batcher receives the
+// items that were already sent to it first, so that they are flushed
+// too. It returns nil if subCtx is canceled first.
+func (m *grouped[T, K, E]) requestFlush(subRec *sub[T, K]) chan struct{} {
+	ack := make(chan struct{})
+	select {
+	case subRec.flush <- flushReq{ack: ack, after: subRec.sent}:
+		return ack
+	case <-m.subCtx.Done():
+		return nil
+	}
+}
+
+func (m *grouped[T, K, E]) enqueueForCleanup(rec *sub[T, K]) {
 	if m.debug != nil {
 		fmt.Fprintf(m.debug, "evictq: key=%v lifetime=%d\n",
 			rec.key, m.window.Lifetime())
@@ -214,16 +668,28 @@ func (m *grouped[T, K]) enqueueForCleanup(rec *sub[T, K]) {
 	}
 
 	if !atomic.CompareAndSwapUint64(&rec.state, stateRunning, stateClosing) {
+		if m.idleTimeout > 0 || m.maxGroups > 0 {
+			// already stopped because it was idle, or to make
+			// room for another, and now it has fallen out
+			// of the window as well
+			return
+		}
 		panic("state != stateRunning")
 	}
 
+	m.setLive(m.live - 1)
+	m.subParams.observeGroupEvicted()
+	if m.lru != nil {
+		m.lru.Delete(rec.key)
+	}
+
 	close(rec.ch)
 	m.evictq <- rec
 	// What happens if we skip evictq and start a goroutine here
 	// to wait for rec.wg and remove it from m.active directly?
 }
 
-func (m *grouped[T, K]) cleanup() {
+func (m *grouped[T, K, E]) cleanup() {
 	for evictee := range m.evictq {
 		if m.debug != nil {
 			fmt.Fprintf(m.debug,
@@ -278,10 +744,81 @@ func (m *grouped[T, K]) cleanup() {
 // GroupedParams embeds Params, which controls the batching behaviour
 // for each group. GroupedParams also introduces new parameters specific
 // to group control, e.g. for the cleanup of idle sub-batchers.
+// opts change how the grouping batcher works, see GroupedOption.
 func StartGrouped[T any, K comparable](
 	in <-chan T, out chan<- []T, keyer func(T) K, wg *sync.WaitGroup,
-	params GroupedParams,
+	params GroupedParams, opts ...GroupedOption[K],
 ) {
+	StartGroupedContext(context.Background(), in, out, keyer, wg, params,
+		opts...)
+}
+
+// StartGroupedContext is like StartGrouped, but the grouping batcher
+// also exits when ctx is canceled. Like BatchContext, once ctx is
+// canceled, no more items are received from in. Items already received
+// are sent on out in their sub-batches, unless params.DropOnCancel is
+// true, in which case they are discarded. out is closed after all
+// sub-batchers exit.
+//
+// The returned channel receives the context error, or nil if in was
+// closed first, once the grouping batcher exits. It is then closed.
+func StartGroupedContext[T any, K comparable](
+	ctx context.Context, in <-chan T, out chan<- []T, keyer func(T) K,
+	wg *sync.WaitGroup, params GroupedParams, opts ...GroupedOption[K],
+) <-chan error {
+	return NewGrouped(ctx, in, out, keyer, wg, params, opts...).errc
+}
+
+// NewGrouped starts a grouping batcher, like StartGroupedContext,
+// and returns its Handle.
+func NewGrouped[T any, K comparable](
+	ctx context.Context, in <-chan T, out chan<- []T, keyer func(T) K,
+	wg *sync.WaitGroup, params GroupedParams, opts ...GroupedOption[K],
+) *Handle {
+	return startGrouped(ctx, in, out, keyer, wg, params, opts,
+		func(e Envelope[T], _ K, _ bool) []T { return e.Items })
+}
+
+// StartGroupedEnvelopes is like StartGroupedContext, but it sends each
+// batch wrapped in a GroupedEnvelope, which carries the key of the group.
+func StartGroupedEnvelopes[T any, K comparable](
+	ctx context.Context, in <-chan T, out chan<- GroupedEnvelope[T, K],
+	keyer func(T) K, wg *sync.WaitGroup, params GroupedParams,
+	opts ...GroupedOption[K],
+) <-chan error {
+	return startGrouped(ctx, in, out, keyer, wg, params, opts,
+		func(e Envelope[T], key K, overflow bool) GroupedEnvelope[T, K] {
+			if overflow {
+				return GroupedEnvelope[T, K]{Envelope: e, Overflow: true}
+			}
+			return GroupedEnvelope[T, K]{Envelope: e, Key: key}
+		}).errc
+}
+
+func startGrouped[T any, K comparable, E any](
+	ctx context.Context, in <-chan T, out chan<- E, keyer func(T) K,
+	wg *sync.WaitGroup, params GroupedParams, opts []GroupedOption[K],
+	wrap func(Envelope[T], K, bool) E,
+) *Handle {
+	m := newGrouped(ctx, in, out, keyer, wg, params, opts, wrap)
+	m.exit = m.exitAlone
+	m.run()
+	return m.h
+}
+
+// newGrouped sets up a grouping batcher without starting it.
+// The caller must set exit, then call run.
+func newGrouped[T any, K comparable, E any](
+	ctx context.Context, in <-chan T, out chan<- E, keyer func(T) K,
+	wg *sync.WaitGroup, params GroupedParams, opts []GroupedOption[K],
+	wrap func(Envelope[T], K, bool) E,
+) *grouped[T, K, E] {
+	if params.MaxGroups > 0 && params.GroupLimitPolicy == GroupLimitBlock &&
+		params.IdleTimeout <= 0 {
+		// nothing would ever make room for a new sub-batcher
+		panic("GroupLimitBlock requires IdleTimeout")
+	}
+
 	if params.SubChannelCap == 0 {
 		if cap(in) < params.Threshold {
 			params.SubChannelCap = cap(in)
@@ -301,30 +838,75 @@ func StartGrouped[T any, K comparable](
 		mapsize = 100 // just a guess
 	}
 
-	m := &grouped[T, K]{
-		active:    make(map[K]*sub[T, K], mapsize),
-		wg:        wg,
-		in:        in,
-		out:       out,
-		subParams: params.Params,
-		subChCap:  params.SubChannelCap,
-		keyer:     keyer,
+	subCtx := context.Background()
+	if params.DropOnCancel {
+		subCtx = ctx
+	}
+
+	clk := params.Clock
+	if clk == nil {
+		clk = clock.Real{}
+	}
+
+	m := &grouped[T, K, E]{
+		active:      make(map[K]*sub[T, K], mapsize),
+		ctx:         ctx,
+		subCtx:      subCtx,
+		h:           newHandle(),
+		wg:          wg,
+		in:          in,
+		out:         out,
+		wrap:        wrap,
+		subParams:   params.Params,
+		subChCap:    params.SubChannelCap,
+		keyer:       keyer,
+		clock:       clk,
+		idleTimeout: params.IdleTimeout,
+		maxGroups:   params.MaxGroups,
+		groupPolicy: params.GroupLimitPolicy,
 		// debug:     os.Stderr,
 	}
 
+	var o groupedOptions[K]
+	for _, opt := range opts {
+		opt(&o)
+	}
+	m.paramsFor = o.paramsFor
+
 	if params.Lifetime > 0 {
-		// TODO: This chan can be smaller, but by how much?
-		m.evictq = make(chan *sub[T, K], params.Lifetime)
 		// no need for the locked counter, since
 		// Observe is only called serially from acceptOne
 		m.window = slidingwindow.NewCounter(
 			params.Lifetime, params.KeyCardinalityHint, m.enqueueForCleanup)
-		wg.Add(1)
-		go m.cleanup()
 	} else {
 		m.window = noopWindow[*sub[T, K]]{}
 	}
 
-	wg.Add(1)
+	if params.MaxGroups > 0 && params.GroupLimitPolicy == GroupLimitEvictLRU {
+		m.lru = lmap.New[K, *sub[T, K]]()
+	}
+
+	if params.Lifetime > 0 || params.IdleTimeout > 0 || params.MaxGroups > 0 {
+		// TODO: This chan can be smaller, but by how much?
+		m.evictq = make(chan *sub[T, K], mapsize)
+	}
+
+	return m
+}
+
+// exitAlone is exit for a grouping batcher that is not a shard.
+func (m *grouped[T, K, E]) exitAlone(err error) {
+	close(m.out)
+	m.h.exit(err)
+}
+
+// run starts the accept and cleanup goroutines.
+func (m *grouped[T, K, E]) run() {
+	if m.evictq != nil {
+		m.wg.Add(1)
+		go m.cleanup()
+	}
+
+	m.wg.Add(1)
 	go m.accept()
 }
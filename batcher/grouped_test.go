@@ -1,11 +1,14 @@
 package batcher
 
 import (
+	"context"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"go.lepak.sg/playground/clock"
 	"go.lepak.sg/playground/testutils"
 	"go.uber.org/goleak"
 	"golang.org/x/exp/slices"
@@ -18,7 +21,7 @@ func (c char) String() string {
 }
 
 // static type assertion
-var _ *grouped[string, char] = nil
+var _ *grouped[string, char, []string] = nil
 
 func stringKeyer(str string) char {
 	if len(str) == 0 {
@@ -192,3 +195,481 @@ func TestStartGrouped(t *testing.T) {
 		}
 	}
 }
+
+func TestStartGroupedContext(t *testing.T) {
+	tests := []struct {
+		name      string
+		drop      bool
+		drainFunc func(*testing.T, [][]string)
+	}{
+		{
+			name: "flush",
+			drainFunc: func(t *testing.T, d [][]string) {
+				assert.ElementsMatch(t, d, [][]string{
+					{"apple", "apricot"},
+					{"banana"},
+				})
+			},
+		},
+		{
+			name: "drop",
+			drop: true,
+			drainFunc: func(t *testing.T, d [][]string) {
+				assert.Empty(t, d)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			in := make(chan string)
+			out := make(chan []string, 2)
+			received := make(chan struct{}, 3)
+
+			var wg sync.WaitGroup
+			errc := StartGroupedContext(ctx, in, out, stringKeyer, &wg,
+				GroupedParams{
+					Params: Params{
+						Threshold:    10,
+						Interval:     time.Hour,
+						DropOnCancel: tt.drop,
+						Hooks: Hooks{
+							OnItem: func() { received <- struct{}{} },
+						},
+					},
+				})
+
+			in <- "apple"
+			in <- "banana"
+			in <- "apricot"
+			// wait for the sub-batchers to receive the items
+			for i := 0; i < 3; i++ {
+				<-received
+			}
+			cancel()
+
+			wg.Wait()
+			assert.ErrorIs(t, <-errc, context.Canceled)
+
+			var drain [][]string
+			for d := range out {
+				drain = append(drain, d)
+			}
+			tt.drainFunc(t, drain)
+			goleak.VerifyNone(t)
+		})
+	}
+}
+
+func TestStartGrouped_IdleTimeout(t *testing.T) {
+	in := make(chan string)
+	out := make(chan []string, 4)
+	clk := clock.NewFake(time.Unix(0, 0))
+
+	var wg sync.WaitGroup
+	StartGrouped(in, out, stringKeyer, &wg, GroupedParams{
+		Params: Params{
+			Threshold: 10,
+			Interval:  time.Hour,
+			Clock:     clk,
+		},
+		IdleTimeout: time.Second,
+	})
+
+	in <- "apple"
+	// sub-batcher timer and idle timer
+	clk.WaitTimers(2)
+	clk.Advance(500 * time.Millisecond)
+	in <- "banana"
+	clk.WaitTimers(3)
+
+	// only 'a' has been idle long enough
+	clk.Advance(500 * time.Millisecond)
+	assert.Equal(t, []string{"apple"}, <-out)
+
+	// a new sub-batcher for 'a'
+	in <- "apricot"
+	clk.WaitTimers(3)
+	clk.Advance(500 * time.Millisecond)
+	assert.Equal(t, []string{"banana"}, <-out)
+
+	close(in)
+	wg.Wait()
+	testutils.Drain(t, [][]string{{"apricot"}}, out)
+	goleak.VerifyNone(t)
+}
+
+func TestStartGrouped_MaxGroups(t *testing.T) {
+	t.Run("evict lru", func(t *testing.T) {
+		in := make(chan string)
+		out := make(chan []string, 4)
+
+		var wg sync.WaitGroup
+		h := NewGrouped(context.Background(), in, out, stringKeyer, &wg,
+			GroupedParams{
+				Params: Params{
+					Threshold: 10,
+					Interval:  time.Hour,
+				},
+				MaxGroups:        2,
+				GroupLimitPolicy: GroupLimitEvictLRU,
+			})
+
+		in <- "apple"
+		in <- "banana"
+		in <- "apricot"
+		// 'b' is the least recently used
+		in <- "cherry"
+		assert.NoError(t, h.Flush(context.Background()))
+		assert.Equal(t, 2, h.Groups())
+
+		close(in)
+		wg.Wait()
+		assert.Equal(t, 0, h.Groups())
+
+		var drain [][]string
+		for d := range out {
+			drain = append(drain, d)
+		}
+		// 'a' was not evicted, so it was sent in one batch
+		assert.ElementsMatch(t, [][]string{
+			{"banana"},
+			{"apple", "apricot"},
+			{"cherry"},
+		}, drain)
+		goleak.VerifyNone(t)
+	})
+
+	t.Run("block", func(t *testing.T) {
+		in := make(chan string)
+		out := make(chan []string, 4)
+		clk := clock.NewFake(time.Unix(0, 0))
+
+		var wg sync.WaitGroup
+		h := NewGrouped(context.Background(), in, out, stringKeyer, &wg,
+			GroupedParams{
+				Params: Params{
+					Threshold: 10,
+					Interval:  time.Hour,
+					Clock:     clk,
+				},
+				IdleTimeout:      time.Second,
+				MaxGroups:        1,
+				GroupLimitPolicy: GroupLimitBlock,
+			})
+
+		in <- "apple"
+		// blocks in accept until 'a' is idle
+		in <- "banana"
+		assert.Equal(t, 1, h.Groups())
+		clk.WaitTimers(2)
+		clk.Advance(time.Second)
+		assert.Equal(t, []string{"apple"}, <-out)
+
+		close(in)
+		wg.Wait()
+		testutils.Drain(t, [][]string{{"banana"}}, out)
+		goleak.VerifyNone(t)
+	})
+
+	t.Run("block canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		in := make(chan string)
+		out := make(chan GroupedEnvelope[string, char], 4)
+		clk := clock.NewFake(time.Unix(0, 0))
+
+		var stats Stats
+		var wg sync.WaitGroup
+		errc := StartGroupedEnvelopes(ctx, in, out, stringKeyer, &wg,
+			GroupedParams{
+				Params: Params{
+					Threshold: 10,
+					Interval:  time.Hour,
+					Clock:     clk,
+					Stats:     &stats,
+				},
+				IdleTimeout:      time.Second,
+				MaxGroups:        1,
+				GroupLimitPolicy: GroupLimitBlock,
+			})
+
+		in <- "apple"
+		// blocks in accept until 'a' is idle, which it never is
+		in <- "banana"
+		cancel()
+
+		wg.Wait()
+		assert.ErrorIs(t, <-errc, context.Canceled)
+
+		got := make(map[char][]string)
+		for e := range out {
+			assert.Equal(t, FlushCanceled, e.Reason)
+			got[e.Key] = e.Items
+		}
+		assert.Equal(t, map[char][]string{
+			'a': {"apple"},
+			'b': {"banana"},
+		}, got)
+
+		// no sub-batcher was created for 'b'
+		snap := stats.Snapshot()
+		assert.EqualValues(t, 1, snap.GroupsCreated)
+		assert.EqualValues(t, 2, snap.ItemsIn)
+		assert.EqualValues(t, 2, snap.BatchesOut)
+		goleak.VerifyNone(t)
+	})
+
+	t.Run("overflow", func(t *testing.T) {
+		in := make(chan string)
+		out := make(chan GroupedEnvelope[string, char], 4)
+		clk := clock.NewFake(time.Unix(0, 0))
+
+		var wg sync.WaitGroup
+		errc := StartGroupedEnvelopes(context.Background(), in, out,
+			stringKeyer, &wg, GroupedParams{
+				Params: Params{
+					Threshold: 10,
+					Interval:  time.Hour,
+					Clock:     clk,
+				},
+				IdleTimeout:      time.Second,
+				MaxGroups:        1,
+				GroupLimitPolicy: GroupLimitOverflow,
+			})
+
+		in <- "apple"
+		in <- "banana"
+		in <- "cherry"
+		// batch timers for 'a' and overflow, and the idle timer
+		clk.WaitTimers(3)
+		clk.Advance(time.Second)
+
+		e := <-out
+		assert.Equal(t, char('a'), e.Key)
+		assert.Equal(t, []string{"apple"}, e.Items)
+
+		// the overflow sub-batcher must be flushed
+		// before 'b' gets its own sub-batcher
+		in <- "blueberry"
+		e = <-out
+		assert.True(t, e.Overflow)
+		assert.Equal(t, []string{"banana", "cherry"}, e.Items)
+		assert.Equal(t, FlushManual, e.Reason)
+
+		close(in)
+		wg.Wait()
+		assert.NoError(t, <-errc)
+
+		e = <-out
+		assert.Equal(t, char('b'), e.Key)
+		assert.Equal(t, []string{"blueberry"}, e.Items)
+		_, ok := <-out
+		assert.False(t, ok)
+		goleak.VerifyNone(t)
+	})
+}
+
+func TestStartGrouped_OverflowAfterEviction(t *testing.T) {
+	const times = 10 // detect flakiness
+
+	for i := 0; i < times; i++ {
+		in := make(chan string)
+		out := make(chan []string, 4)
+		clk := clock.NewFake(time.Unix(0, 0))
+
+		// the last batch of 'a' is held back until apricot
+		// has been received, so 'a' is still closing then
+		evicted := make(chan struct{}, 1)
+		release := make(chan struct{})
+		var held uint32
+		var wg sync.WaitGroup
+		NewGrouped(context.Background(), in, out, stringKeyer, &wg,
+			GroupedParams{
+				Params: Params{
+					Threshold: 10,
+					Interval:  time.Hour,
+					Clock:     clk,
+					Hooks: Hooks{
+						OnBatch: func(int, FlushReason) {
+							if atomic.CompareAndSwapUint32(&held, 0, 1) {
+								<-release
+							}
+						},
+						OnGroupEvicted: func() {
+							evicted <- struct{}{}
+						},
+					},
+				},
+				IdleTimeout:      time.Second,
+				MaxGroups:        1,
+				GroupLimitPolicy: GroupLimitOverflow,
+			})
+
+		in <- "apple"
+		// batch timer for 'a', and the idle timer
+		clk.WaitTimers(2)
+		clk.Advance(time.Second)
+		<-evicted
+
+		in <- "banana"
+		// 'a' is still closing, and there is no room for it,
+		// so this goes to the overflow sub-batcher
+		in <- "apricot"
+		close(release)
+		close(in)
+		wg.Wait()
+
+		var got []string
+		for batch := range out {
+			got = append(got, batch...)
+		}
+		assert.ElementsMatch(t, []string{"apple", "banana", "apricot"}, got)
+		assert.Less(t, slices.Index(got, "apple"), slices.Index(got, "apricot"),
+			"same-key order broken")
+	}
+
+	goleak.VerifyNone(t)
+}
+
+func TestWithKeyParams(t *testing.T) {
+	params := GroupedParams{
+		Params: Params{
+			Threshold: 10,
+			Interval:  time.Hour,
+		},
+	}
+	want := [][]string{
+		{"apple"},
+		{"apricot"},
+		{"banana", "blueberry", "blackcurrant"},
+		{"cherry"},
+	}
+
+	collect := func(out <-chan []string) [][]string {
+		var got [][]string
+		for batch := range out {
+			got = append(got, batch)
+		}
+		return got
+	}
+
+	tests := []struct {
+		name  string
+		start func(in <-chan string, wg *sync.WaitGroup,
+			opt GroupedOption[char]) (<-chan error, func() [][]string)
+	}{
+		{
+			name: "grouped",
+			start: func(in <-chan string, wg *sync.WaitGroup,
+				opt GroupedOption[char]) (<-chan error, func() [][]string) {
+				out := make(chan []string, 6)
+				errc := StartGroupedContext(context.Background(), in, out,
+					stringKeyer, wg, params, opt)
+				return errc, func() [][]string { return collect(out) }
+			},
+		},
+		{
+			name: "sharded",
+			start: func(in <-chan string, wg *sync.WaitGroup,
+				opt GroupedOption[char]) (<-chan error, func() [][]string) {
+				out := make(chan []string, 6)
+				h := NewGroupedSharded(context.Background(), in, out,
+					stringKeyer, charHash, 2, wg, params, opt)
+				return h.errc, func() [][]string { return collect(out) }
+			},
+		},
+		{
+			name: "seq",
+			start: func(in <-chan string, wg *sync.WaitGroup,
+				opt GroupedOption[char]) (<-chan error, func() [][]string) {
+				out := make(chan SeqBatch[string], 6)
+				errc := StartGroupedSeq(context.Background(), in, out,
+					stringKeyer, wg, params, opt)
+				return errc, func() [][]string {
+					var got [][]string
+					for b := range out {
+						got = append(got, b.Items)
+					}
+					return got
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := make(chan string, 6)
+
+			in <- "apple"
+			in <- "banana"
+			in <- "apricot"
+			in <- "blueberry"
+			in <- "blackcurrant"
+			in <- "cherry"
+			close(in)
+
+			// each shard calls paramsFor from its own goroutine,
+			// but only for its own keys
+			var mu sync.Mutex
+			called := make(map[char]int)
+
+			var wg sync.WaitGroup
+			errc, got := tt.start(in, &wg,
+				WithKeyParams(func(key char) Params {
+					mu.Lock()
+					called[key]++
+					mu.Unlock()
+					if key == 'a' {
+						return Params{Threshold: 1}
+					}
+					return Params{Threshold: 3, Interval: time.Hour}
+				}))
+			wg.Wait()
+			assert.NoError(t, <-errc)
+
+			assert.ElementsMatch(t, want, got())
+			assert.Equal(t, map[char]int{'a': 1, 'b': 1, 'c': 1}, called)
+			goleak.VerifyNone(t)
+		})
+	}
+}
+
+func TestWithKeyParams_Envelopes(t *testing.T) {
+	in := make(chan string, 3)
+	out := make(chan GroupedEnvelope[string, char], 3)
+
+	in <- "apple"
+	in <- "banana"
+	in <- "apricot"
+	close(in)
+
+	var wg sync.WaitGroup
+	errc := StartGroupedEnvelopes(context.Background(), in, out,
+		stringKeyer, &wg, GroupedParams{
+			Params: Params{
+				Threshold: 10,
+				Interval:  time.Hour,
+			},
+		},
+		WithKeyParams(func(key char) Params {
+			if key == 'a' {
+				return Params{Threshold: 2, Interval: time.Hour}
+			}
+			return Params{Threshold: 10, Interval: time.Hour}
+		}))
+	wg.Wait()
+	assert.NoError(t, <-errc)
+
+	got := make(map[char]FlushReason)
+	for e := range out {
+		got[e.Key] = e.Reason
+	}
+	assert.Equal(t, map[char]FlushReason{
+		'a': FlushThreshold,
+		'b': FlushClosed,
+	}, got)
+	goleak.VerifyNone(t)
+}
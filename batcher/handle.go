@@ -0,0 +1,134 @@
+package batcher
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// Handle controls a running batcher. It is returned by New and
+// NewGrouped.
+type Handle struct {
+	flush chan flushReq
+
+	// errc receives err, then is closed. It is returned by
+	// the Start*Context functions, which don't return a Handle
+	errc chan error
+	done chan struct{}
+	err  error
+
+	// atomic, only set by grouping batchers
+	groups int64
+	// the handles of each shard of a sharded grouping batcher,
+	// only used to count groups
+	shards []*Handle
+}
+
+// flushReq asks a batcher to flush. The batcher first receives after
+// items in total, counting from when it started, so that items that
+// were sent to it before the request are flushed too. Then it sends
+// its partial batch and closes ack.
+type flushReq struct {
+	ack   chan struct{}
+	after uint64
+}
+
+func newHandle() *Handle {
+	return &Handle{
+		flush: make(chan flushReq),
+		errc:  make(chan error, 1),
+		done:  make(chan struct{}),
+	}
+}
+
+// exit must be called exactly once, after the batcher has
+// closed its out channel.
+func (h *Handle) exit(err error) {
+	h.err = err
+	h.errc <- err
+	close(h.errc)
+	close(h.done)
+}
+
+// Flush makes the batcher send its partial batches right away,
+// without waiting for the threshold or interval to be reached.
+// For a grouping batcher, every sub-batcher sends its partial batch,
+// including items that the grouping batcher has already received from
+// the in channel but the sub-batcher hasn't. Batches sent because of
+// Flush have the reason FlushManual.
+//
+// Flush returns nil once all the partial batches have been sent on out,
+// so it will block until they are received. If ctx is canceled before
+// that, Flush returns the context error, and the partial batches may
+// or may not be sent. If the batcher has already exited, there is
+// nothing to flush, so Flush returns nil immediately.
+//
+// Flush may be called from multiple goroutines at once.
+func (h *Handle) Flush(ctx context.Context) error {
+	ack := make(chan struct{})
+
+	select {
+	case h.flush <- flushReq{ack: ack}:
+	case <-h.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case <-ack:
+		return nil
+	case <-h.done:
+		// it exited before it could flush, e.g. because its
+		// context was canceled, after sending what it had
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Wait waits for the batcher to exit, then returns nil if the in
+// channel was closed, or the context error if the context was canceled.
+func (h *Handle) Wait() error {
+	<-h.done
+	return h.err
+}
+
+// Groups returns the number of sub-batchers that a grouping batcher
+// has running, excluding the overflow sub-batcher. It is always 0 for
+// a batcher that was not created by NewGrouped or NewGroupedSharded.
+func (h *Handle) Groups() int {
+	if h.shards != nil {
+		var n int
+		for _, s := range h.shards {
+			n += s.Groups()
+		}
+		return n
+	}
+	return int(atomic.LoadInt64(&h.groups))
+}
+
+// New starts a batcher, like StartContext, and returns its Handle.
+func New[T any](
+	ctx context.Context, in <-chan T, out chan<- []T, wg *sync.WaitGroup,
+	params Params,
+) *Handle {
+	return start(ctx, in, out, items[T], batchExt[T]{}, wg, params)
+}
+
+func start[T, E any](
+	ctx context.Context, in <-chan T, out chan<- E, wrap func(Envelope[T]) E,
+	ext batchExt[T], wg *sync.WaitGroup, params Params,
+) *Handle {
+	h := newHandle()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := batch(ctx, in, out, wrap, h.flush, ext, params)
+		close(out)
+		h.exit(err)
+	}()
+
+	return h
+}
@@ -0,0 +1,175 @@
+package batcher
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.lepak.sg/playground/testutils"
+	"go.uber.org/goleak"
+)
+
+func TestHandle_Flush(t *testing.T) {
+	in := make(chan int)
+	out := make(chan []int, 3)
+
+	var wg sync.WaitGroup
+	h := New(context.Background(), in, out, &wg, Params{
+		Threshold: 10,
+		Interval:  time.Hour,
+	})
+
+	// nothing to flush
+	assert.NoError(t, h.Flush(context.Background()))
+
+	for i := 0; i < 3; i++ {
+		in <- i
+	}
+	assert.NoError(t, h.Flush(context.Background()))
+
+	in <- 3
+	close(in)
+
+	wg.Wait()
+	assert.NoError(t, h.Wait())
+	// the batcher has exited
+	assert.NoError(t, h.Flush(context.Background()))
+	testutils.Drain(t, [][]int{{0, 1, 2}, {3}}, out)
+	goleak.VerifyNone(t)
+}
+
+func TestHandle_FlushGrouped(t *testing.T) {
+	in := make(chan string)
+	out := make(chan []string, 4)
+
+	var wg sync.WaitGroup
+	h := NewGrouped(context.Background(), in, out, stringKeyer, &wg,
+		GroupedParams{
+			Params: Params{
+				Threshold: 10,
+				Interval:  time.Hour,
+			},
+			SubChannelCap: 10,
+		})
+
+	in <- "apple"
+	in <- "banana"
+	in <- "apricot"
+	assert.NoError(t, h.Flush(context.Background()))
+
+	var flushed [][]string
+	for len(out) > 0 {
+		flushed = append(flushed, <-out)
+	}
+	assert.ElementsMatch(t, [][]string{
+		{"apple", "apricot"},
+		{"banana"},
+	}, flushed)
+
+	in <- "blueberry"
+	close(in)
+
+	wg.Wait()
+	assert.NoError(t, h.Wait())
+	testutils.Drain(t, [][]string{{"blueberry"}}, out)
+	goleak.VerifyNone(t)
+}
+
+func TestHandle_FlushContext(t *testing.T) {
+	in := make(chan int)
+	// unbuffered and nobody is receiving, so the flush can't finish
+	out := make(chan []int)
+
+	var wg sync.WaitGroup
+	h := New(context.Background(), in, out, &wg, Params{
+		Threshold: 10,
+		Interval:  time.Hour,
+	})
+
+	in <- 1
+
+	ctx, cancel := context.WithTimeout(context.Background(),
+		100*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, h.Flush(ctx), context.DeadlineExceeded)
+
+	close(in)
+	assert.Equal(t, []int{1}, <-out)
+	wg.Wait()
+	testutils.Drain(t, nil, out)
+	goleak.VerifyNone(t)
+}
+
+func TestBatch_FlushAfter(t *testing.T) {
+	in := make(chan int, 10)
+	out := make(chan Envelope[int], 10)
+	flush := make(chan flushReq)
+
+	errc := make(chan error)
+	go func() {
+		errc <- batch(context.Background(), in, out,
+			func(e Envelope[int]) Envelope[int] { return e },
+			flush, batchExt[int]{}, Params{
+				Threshold: 10,
+				Interval:  time.Hour,
+			})
+	}()
+
+	// the request waits for the 3 items sent before it, even
+	// though the batcher hasn't received them yet
+	in <- 1
+	ack := make(chan struct{})
+	flush <- flushReq{ack: ack, after: 3}
+	in <- 2
+	in <- 3
+	in <- 4
+	<-ack
+
+	e := <-out
+	assert.Equal(t, []int{1, 2, 3}, e.Items)
+	assert.Equal(t, FlushManual, e.Reason)
+
+	close(in)
+	assert.NoError(t, <-errc)
+	e = <-out
+	assert.Equal(t, []int{4}, e.Items)
+	assert.Equal(t, FlushClosed, e.Reason)
+	goleak.VerifyNone(t)
+}
+
+func TestHandle_FlushGroupedSlowConsumer(t *testing.T) {
+	in := make(chan string)
+	out := make(chan []string)
+
+	var wg sync.WaitGroup
+	h := NewGrouped(context.Background(), in, out, stringKeyer, &wg,
+		GroupedParams{
+			Params: Params{
+				Threshold: 2,
+				Interval:  time.Hour,
+			},
+			SubChannelCap: 10,
+		})
+
+	// the sub-batcher is blocked sending {a1 a2},
+	// while a3 is still in its channel
+	in <- "a1"
+	in <- "a2"
+	in <- "a3"
+
+	flushed := make(chan error)
+	go func() {
+		flushed <- h.Flush(context.Background())
+	}()
+
+	assert.Equal(t, []string{"a1", "a2"}, <-out)
+	assert.Equal(t, []string{"a3"}, <-out)
+	assert.NoError(t, <-flushed)
+
+	close(in)
+	wg.Wait()
+	testutils.Drain(t, nil, out)
+	goleak.VerifyNone(t)
+}
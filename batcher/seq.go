@@ -0,0 +1,162 @@
+package batcher
+
+import (
+	"context"
+	"sync"
+
+	"go.lepak.sg/playground/heap"
+)
+
+// SeqBatch is a batch of items sent by StartGroupedSeq. Each item is
+// tagged with its sequence number, which is its position in the input
+// channel: the first item received has sequence number 0, the next
+// has 1, and so on. Seqs[i] is the sequence number of Items[i].
+type SeqBatch[T any] struct {
+	Items []T
+	Seqs  []uint64
+}
+
+// First returns the sequence number of the first item in the batch.
+func (b SeqBatch[T]) First() uint64 {
+	return b.Seqs[0]
+}
+
+// Last returns the sequence number of the last item in the batch.
+// Items with sequence numbers between First and Last may be in
+// other batches, since they may have other keys.
+func (b SeqBatch[T]) Last() uint64 {
+	return b.Seqs[len(b.Seqs)-1]
+}
+
+type sequenced[T any] struct {
+	seq  uint64
+	item T
+}
+
+// StartGroupedSeq is like StartGroupedContext, but it sends each batch
+// as a SeqBatch, so that the position of every item in the input is
+// known. Pass the out channel to Reorder to receive the batches in
+// input order.
+//
+// StartGroupedSeq starts an extra goroutine, which tags items with
+// their sequence numbers, and which is also counted in wg.
+func StartGroupedSeq[T any, K comparable](
+	ctx context.Context, in <-chan T, out chan<- SeqBatch[T], keyer func(T) K,
+	wg *sync.WaitGroup, params GroupedParams, opts ...GroupedOption[K],
+) <-chan error {
+	tagged := make(chan sequenced[T], cap(in))
+	done := ctx.Done()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(tagged)
+
+		var seq uint64
+		for {
+			select {
+			case <-done:
+				return
+			case item, ok := <-in:
+				if !ok {
+					return
+				}
+
+				select {
+				case tagged <- sequenced[T]{seq: seq, item: item}:
+					seq++
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+
+	return startGrouped(ctx, tagged, out,
+		func(s sequenced[T]) K { return keyer(s.item) }, wg, params, opts,
+		func(e Envelope[sequenced[T]], _ K, _ bool) SeqBatch[T] {
+			b := SeqBatch[T]{
+				Items: make([]T, len(e.Items)),
+				Seqs:  make([]uint64, len(e.Items)),
+			}
+			for i, s := range e.Items {
+				b.Items[i] = s.item
+				b.Seqs[i] = s.seq
+			}
+			return b
+		}).errc
+}
+
+// seqHeap is a min-heap of batches ordered by their first
+// sequence number.
+type seqHeap[T any] []SeqBatch[T]
+
+func (h seqHeap[_]) Len() int {
+	return len(h)
+}
+
+func (h seqHeap[_]) Less(i, j int) bool {
+	return h[i].First() < h[j].First()
+}
+
+func (h seqHeap[_]) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+func (h *seqHeap[T]) Push(x SeqBatch[T]) {
+	*h = append(*h, x)
+}
+
+func (h *seqHeap[T]) Pop() SeqBatch[T] {
+	x := (*h)[len(*h)-1]
+	*h = (*h)[:len(*h)-1]
+	return x
+}
+
+// Reorder receives batches from StartGroupedSeq and sends them on out
+// in input order. A batch is held back until every item with a lower
+// sequence number than its first item has been received by Reorder,
+// so batches are sent in order of their first sequence numbers.
+// This makes it possible to record progress through the input, like
+// with package doneq: once a batch has been sent on out, every item
+// before the batch's first item has been sent as well.
+//
+// Reorder exits after in is closed, and it will close out as well.
+// Batches that are still held back then, because some items were
+// never received (e.g. they were dropped when the context was
+// canceled), are sent in order before out is closed.
+func Reorder[T any](in <-chan SeqBatch[T], out chan<- SeqBatch[T]) {
+	defer close(out)
+
+	var held seqHeap[T]
+	// next is the lowest sequence number not received yet,
+	// and received holds the ones above it that were received
+	var next uint64
+	received := make(map[uint64]struct{})
+
+	for b := range in {
+		if len(b.Seqs) == 0 {
+			continue
+		}
+
+		for _, seq := range b.Seqs {
+			received[seq] = struct{}{}
+		}
+		for {
+			if _, ok := received[next]; !ok {
+				break
+			}
+			delete(received, next)
+			next++
+		}
+
+		heap.Push[SeqBatch[T]](&held, b)
+		for held.Len() > 0 && held[0].First() <= next {
+			out <- heap.Pop[SeqBatch[T]](&held)
+		}
+	}
+
+	for held.Len() > 0 {
+		out <- heap.Pop[SeqBatch[T]](&held)
+	}
+}
@@ -0,0 +1,77 @@
+package batcher
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+func TestReorder(t *testing.T) {
+	batches := []SeqBatch[string]{
+		{Items: []string{"c", "f"}, Seqs: []uint64{2, 5}},
+		{Items: []string{"b", "e"}, Seqs: []uint64{1, 4}},
+		{Items: []string{"g"}, Seqs: []uint64{6}},
+		{Items: []string{"a", "d"}, Seqs: []uint64{0, 3}},
+		// 7 is missing
+		{Items: []string{"i"}, Seqs: []uint64{8}},
+	}
+
+	in := make(chan SeqBatch[string], len(batches))
+	out := make(chan SeqBatch[string], len(batches))
+	for _, b := range batches {
+		in <- b
+	}
+	close(in)
+
+	Reorder(in, out)
+
+	var firsts []uint64
+	for b := range out {
+		firsts = append(firsts, b.First())
+	}
+	assert.Equal(t, []uint64{0, 1, 2, 6, 8}, firsts)
+}
+
+func TestStartGroupedSeq(t *testing.T) {
+	in := make(chan int, 9)
+	mid := make(chan SeqBatch[int])
+	out := make(chan SeqBatch[int], 6)
+
+	for i := 0; i < 9; i++ {
+		in <- i * 10
+	}
+	close(in)
+
+	var wg sync.WaitGroup
+	errc := StartGroupedSeq(context.Background(), in, mid,
+		func(i int) int { return i % 3 }, &wg, GroupedParams{
+			Params: Params{
+				Threshold: 2,
+				Interval:  time.Second,
+			},
+		})
+	Reorder(mid, out)
+
+	wg.Wait()
+	assert.NoError(t, <-errc)
+
+	var got []SeqBatch[int]
+	for b := range out {
+		got = append(got, b)
+	}
+
+	// regardless of the order that the sub-batchers sent them in
+	assert.Equal(t, []SeqBatch[int]{
+		{Items: []int{0, 30}, Seqs: []uint64{0, 3}},
+		{Items: []int{10, 40}, Seqs: []uint64{1, 4}},
+		{Items: []int{20, 50}, Seqs: []uint64{2, 5}},
+		{Items: []int{60}, Seqs: []uint64{6}},
+		{Items: []int{70}, Seqs: []uint64{7}},
+		{Items: []int{80}, Seqs: []uint64{8}},
+	}, got)
+	goleak.VerifyNone(t)
+}
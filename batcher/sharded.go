@@ -0,0 +1,224 @@
+package batcher
+
+import (
+	"context"
+	"sync"
+)
+
+// sharded spreads items across several grouping batchers by the hash
+// of their keys. Each shard has its own accept loop, active map and
+// sliding window, so shards don't contend with each other. Since all
+// items with the same key go to the same shard, the ordering and
+// eviction properties of the grouping batcher hold for every key.
+type sharded[T any, K comparable] struct {
+	ctx context.Context
+	in  <-chan T
+	out chan<- []T
+	// dispatch serves flush requests from h, and the last of
+	// the shards and dispatch to exit calls h.exit
+	h *Handle
+	// shards[i] is the input of the grouping batcher grouped[i],
+	// and sent[i] is the number of items sent on it
+	shards  []chan keyed[T, K]
+	grouped []*grouped[keyed[T, K], K, []T]
+	sent    []uint64
+
+	keyer func(T) K
+	hash  func(K) uint64
+
+	// decremented by dispatch when it exits
+	wg *sync.WaitGroup
+
+	mu      sync.Mutex // protects running and err
+	running int
+	err     error
+}
+
+// keyed is an item together with its key, so that
+// shards don't have to call keyer again.
+type keyed[T any, K comparable] struct {
+	key  K
+	item T
+}
+
+func keyOf[T any, K comparable](x keyed[T, K]) K {
+	return x.key
+}
+
+// unkey unwraps a batch of keyed items into the batch of items
+// that is sent on out.
+func unkey[T any, K comparable](e Envelope[keyed[T, K]], _ K, _ bool) []T {
+	items := make([]T, len(e.Items))
+	for i, x := range e.Items {
+		items[i] = x.item
+	}
+	return items
+}
+
+// NewGroupedSharded starts a grouping batcher, like NewGrouped, that
+// is split into the given number of shards. Each item is sent to the
+// shard chosen by the hash of its key, and each shard is a grouping
+// batcher by itself. keyer and hash are called once for each item, by
+// a single goroutine that hands the item and its key to its shard, so
+// they should be cheap.
+//
+// Every item goes through one more goroutine than with NewGrouped, so
+// sharding only pays off when the shards have enough work to do in
+// parallel: when there are several CPUs for them, or when creating a
+// sub-batcher blocks, e.g. because WithKeyParams looks up the params
+// of each key elsewhere. Otherwise, NewGrouped is faster.
+// BenchmarkGrouped compares the two.
+//
+// All batches are sent on out, which is closed after every shard exits.
+// Batches for different keys may be interleaved differently than
+// with NewGrouped, but items with the same key are still sent in the
+// order that they were received.
+//
+// params is used for every shard, with these differences:
+// Lifetime counts only the items received by the same shard, and
+// MaxGroups limits the number of sub-batchers in each shard.
+// KeyCardinalityHint is divided among the shards.
+//
+// NewGroupedSharded panics if shards is not positive or hash is nil.
+func NewGroupedSharded[T any, K comparable](
+	ctx context.Context, in <-chan T, out chan<- []T, keyer func(T) K,
+	hash func(K) uint64, shards int, wg *sync.WaitGroup,
+	params GroupedParams, opts ...GroupedOption[K],
+) *Handle {
+	if shards <= 0 {
+		panic("invalid shard count")
+	}
+	if hash == nil {
+		panic("hash is nil")
+	}
+
+	if params.KeyCardinalityHint > 0 {
+		params.KeyCardinalityHint =
+			(params.KeyCardinalityHint + shards - 1) / shards
+	}
+
+	s := &sharded[T, K]{
+		ctx:     ctx,
+		in:      in,
+		out:     out,
+		h:       newHandle(),
+		shards:  make([]chan keyed[T, K], shards),
+		grouped: make([]*grouped[keyed[T, K], K, []T], shards),
+		sent:    make([]uint64, shards),
+		keyer:   keyer,
+		hash:    hash,
+		wg:      wg,
+		// every shard and dispatch
+		running: shards + 1,
+	}
+	s.h.shards = make([]*Handle, shards)
+
+	for i := range s.shards {
+		s.shards[i] = make(chan keyed[T, K], cap(in))
+		m := newGrouped(ctx, s.shards[i], out, keyOf[T, K], wg, params,
+			opts, unkey[T, K])
+		m.exit = s.exit
+		s.grouped[i] = m
+		s.h.shards[i] = m.h
+	}
+
+	for _, m := range s.grouped {
+		m.run()
+	}
+
+	wg.Add(1)
+	go s.dispatch()
+
+	return s.h
+}
+
+func (s *sharded[T, K]) dispatch() {
+	var err error
+	done := s.ctx.Done()
+	n := uint64(len(s.shards))
+
+loop:
+	for {
+		select {
+		case <-done:
+			err = s.ctx.Err()
+			break loop
+		case req := <-s.h.flush:
+			if !s.flushAll() {
+				// Flush returns once the shards exit
+				err = s.ctx.Err()
+				break loop
+			}
+			close(req.ack)
+		case item, ok := <-s.in:
+			if !ok {
+				break loop
+			}
+			key := s.keyer(item)
+			i := s.hash(key) % n
+			select {
+			case s.shards[i] <- keyed[T, K]{key: key, item: item}:
+				s.sent[i]++
+			case <-done:
+				// the shard may have exited already
+				err = s.ctx.Err()
+				break loop
+			}
+		}
+	}
+
+	// each shard sends what it has and exits
+	for _, ch := range s.shards {
+		close(ch)
+	}
+	// a shard may see its input closed before ctx is
+	// canceled, and report nil
+	s.exit(err)
+
+	s.wg.Done()
+}
+
+// flushAll flushes every shard, after the shard has received every
+// item that was already dispatched to it. It returns false if ctx is
+// canceled first, since shards stop serving flush requests then.
+func (s *sharded[T, K]) flushAll() bool {
+	done := s.ctx.Done()
+	acks := make([]chan struct{}, len(s.grouped))
+
+	for i, m := range s.grouped {
+		acks[i] = make(chan struct{})
+		select {
+		case m.h.flush <- flushReq{ack: acks[i], after: s.sent[i]}:
+		case <-done:
+			return false
+		}
+	}
+
+	for _, ack := range acks {
+		select {
+		case <-ack:
+		case <-done:
+			return false
+		}
+	}
+
+	return true
+}
+
+// exit is called by each shard once all its sub-batchers have exited,
+// and by dispatch. The last to call it closes out and reports the
+// first error.
+func (s *sharded[T, K]) exit(err error) {
+	s.mu.Lock()
+	if s.err == nil {
+		s.err = err
+	}
+	s.running--
+	last := s.running == 0
+	s.mu.Unlock()
+
+	if last {
+		close(s.out)
+		s.h.exit(s.err)
+	}
+}
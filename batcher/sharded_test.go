@@ -0,0 +1,289 @@
+package batcher
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+func charHash(c char) uint64 {
+	return uint64(c)
+}
+
+func TestNewGroupedSharded(t *testing.T) {
+	const times = 100 // detect flakiness
+
+	for i := 0; i < times; i++ {
+		in := make(chan string, 4)
+		out := make(chan []string)
+
+		// shards get the key along with the item,
+		// so keyer is only called once for each item
+		var calls int64
+		keyer := func(s string) char {
+			atomic.AddInt64(&calls, 1)
+			return stringKeyer(s)
+		}
+
+		var wg sync.WaitGroup
+		h := NewGroupedSharded(context.Background(), in, out, keyer,
+			charHash, 3, &wg, GroupedParams{
+				Params: Params{
+					Threshold: 2,
+					Interval:  time.Hour,
+				},
+				Lifetime: 2,
+			})
+
+		go func() {
+			for _, s := range []string{
+				"apple", "banana", "cherry", "blueberry", "coconut",
+				"blackcurrant", "cantaloupe", "apricot", "avocado",
+				"durian",
+			} {
+				in <- s
+			}
+			close(in)
+		}()
+
+		byKey := make(map[char][]string)
+		for batch := range out {
+			key := stringKeyer(batch[0])
+			for _, item := range batch {
+				assert.Equal(t, key, stringKeyer(item), "mixed batch")
+			}
+			byKey[key] = append(byKey[key], batch...)
+		}
+
+		wg.Wait()
+		assert.NoError(t, h.Wait())
+		assert.Equal(t, map[char][]string{
+			'a': {"apple", "apricot", "avocado"},
+			'b': {"banana", "blueberry", "blackcurrant"},
+			'c': {"cherry", "coconut", "cantaloupe"},
+			'd': {"durian"},
+		}, byKey, "same-key order broken")
+		assert.EqualValues(t, 10, atomic.LoadInt64(&calls))
+	}
+
+	goleak.VerifyNone(t)
+}
+
+func TestNewGroupedSharded_Flush(t *testing.T) {
+	in := make(chan string)
+	out := make(chan []string, 4)
+
+	var wg sync.WaitGroup
+	h := NewGroupedSharded(context.Background(), in, out, stringKeyer,
+		charHash, 2, &wg, GroupedParams{
+			Params: Params{
+				Threshold: 10,
+				Interval:  time.Hour,
+			},
+		})
+
+	in <- "apple"
+	in <- "banana"
+	in <- "apricot"
+	assert.NoError(t, h.Flush(context.Background()))
+	assert.Equal(t, 2, h.Groups())
+
+	var flushed [][]string
+	for len(out) > 0 {
+		flushed = append(flushed, <-out)
+	}
+	assert.ElementsMatch(t, [][]string{
+		{"apple", "apricot"},
+		{"banana"},
+	}, flushed)
+
+	close(in)
+	wg.Wait()
+	assert.NoError(t, h.Wait())
+	assert.Equal(t, 0, h.Groups())
+
+	_, ok := <-out
+	assert.False(t, ok)
+	goleak.VerifyNone(t)
+}
+
+func TestNewGroupedSharded_Context(t *testing.T) {
+	in := make(chan string)
+	out := make(chan []string, 4)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var wg sync.WaitGroup
+	h := NewGroupedSharded(ctx, in, out, stringKeyer, charHash, 4, &wg,
+		GroupedParams{
+			Params: Params{
+				Threshold: 10,
+				Interval:  time.Hour,
+			},
+		})
+
+	in <- "apple"
+	in <- "banana"
+	assert.NoError(t, h.Flush(context.Background()))
+	in <- "apricot"
+	cancel()
+
+	wg.Wait()
+	assert.ErrorIs(t, h.Wait(), context.Canceled)
+
+	var got [][]string
+	for batch := range out {
+		got = append(got, batch)
+	}
+	assert.Contains(t, got, []string{"apple"})
+	assert.Contains(t, got, []string{"banana"})
+	goleak.VerifyNone(t)
+}
+
+func TestNewGroupedSharded_CancelDuringFlush(t *testing.T) {
+	in := make(chan string, 8)
+	// nobody is receiving yet, so the shard falls behind
+	out := make(chan []string)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var wg sync.WaitGroup
+	h := NewGroupedSharded(ctx, in, out, stringKeyer, charHash, 1, &wg,
+		GroupedParams{
+			Params: Params{
+				Threshold: 1,
+				Interval:  time.Hour,
+			},
+		})
+
+	for i := 0; i < cap(in); i++ {
+		in <- fmt.Sprint("a", i)
+	}
+
+	flushed := make(chan error)
+	go func() {
+		flushed <- h.Flush(context.Background())
+	}()
+	cancel()
+
+	// the shard stops receiving items, so the flush can't finish,
+	// but the batcher must still exit
+	go func() {
+		for range out {
+		}
+	}()
+
+	exited := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(exited)
+	}()
+	select {
+	case <-exited:
+	case <-time.After(2 * time.Second):
+		t.Fatal("batcher did not exit")
+	}
+	assert.NoError(t, <-flushed)
+	assert.ErrorIs(t, h.Wait(), context.Canceled)
+	goleak.VerifyNone(t)
+}
+
+func TestNewGroupedSharded_Panic(t *testing.T) {
+	var wg sync.WaitGroup
+	assert.PanicsWithValue(t, "invalid shard count", func() {
+		NewGroupedSharded(context.Background(), nil, nil, stringKeyer,
+			charHash, 0, &wg, GroupedParams{})
+	})
+	assert.PanicsWithValue(t, "hash is nil", func() {
+		NewGroupedSharded[string, char](context.Background(), nil, nil,
+			stringKeyer, nil, 1, &wg, GroupedParams{})
+	})
+}
+
+func BenchmarkGrouped(b *testing.B) {
+	for _, keys := range []int{16, 1024} {
+		b.Run(fmt.Sprintf("keys=%d/unsharded", keys), func(b *testing.B) {
+			benchmarkGrouped(b, keys, 0, 0)
+		})
+		for _, shards := range []int{1, 2, 4, 8} {
+			b.Run(fmt.Sprintf("keys=%d/shards=%d", keys, shards),
+				func(b *testing.B) {
+					benchmarkGrouped(b, keys, shards, 0)
+				})
+		}
+	}
+
+	// creating a sub-batcher blocks, like when the params of each
+	// key are looked up elsewhere, so shards can create them in
+	// parallel even with one CPU
+	const lookup = 100 * time.Microsecond
+	b.Run("keys=1024/lookup/unsharded", func(b *testing.B) {
+		benchmarkGrouped(b, 1024, 0, lookup)
+	})
+	for _, shards := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("keys=1024/lookup/shards=%d", shards),
+			func(b *testing.B) {
+				benchmarkGrouped(b, 1024, shards, lookup)
+			})
+	}
+}
+
+// benchmarkGrouped sends b.N items with the given number of keys
+// through a grouping batcher. If shards is 0, NewGrouped is used,
+// otherwise NewGroupedSharded. If lookup is positive, the params
+// of each sub-batcher take that long to look up.
+func benchmarkGrouped(b *testing.B, keys, shards int, lookup time.Duration) {
+	in := make(chan int, 128)
+	out := make(chan []int, 128)
+	keyer := func(i int) int { return i % keys }
+	hash := func(k int) uint64 { return uint64(k) }
+	params := GroupedParams{
+		Params: Params{
+			Threshold: 64,
+			Interval:  time.Hour,
+			Prealloc:  true,
+		},
+		Lifetime: 4 * keys,
+	}
+
+	var opts []GroupedOption[int]
+	if lookup > 0 {
+		opts = append(opts, WithKeyParams(func(int) Params {
+			time.Sleep(lookup)
+			return params.Params
+		}))
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	var wg sync.WaitGroup
+	if shards == 0 {
+		NewGrouped(context.Background(), in, out, keyer, &wg, params,
+			opts...)
+	} else {
+		NewGroupedSharded(context.Background(), in, out, keyer, hash,
+			shards, &wg, params, opts...)
+	}
+	go func() {
+		for i := 0; i < b.N; i++ {
+			in <- i
+		}
+		close(in)
+	}()
+
+	var n int
+	for batch := range out {
+		n += len(batch)
+	}
+	wg.Wait()
+
+	b.StopTimer()
+	if n != b.N {
+		b.Fatalf("received %d items, want %d", n, b.N)
+	}
+}
@@ -0,0 +1,147 @@
+package batcher
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"go.lepak.sg/playground/clock"
+	"golang.org/x/sync/errgroup"
+)
+
+// SinkParams controls how Sink delivers batches.
+type SinkParams[T any] struct {
+	// Concurrency is the number of batches that may be delivered
+	// at once. If it is more than 1, batches may be delivered out
+	// of order. If this is 0, 1 is used instead.
+	Concurrency int
+
+	// Retries is the number of times delivery of a batch is retried
+	// after the first attempt fails. Before each retry, Sink waits
+	// for a backoff that starts at InitialBackoff, and doubles after
+	// every retry up to MaxBackoff. If InitialBackoff is 0, retries
+	// happen immediately. If MaxBackoff is 0, the backoff stops
+	// doubling only once doubling it would overflow a time.Duration.
+	Retries        int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+
+	// DeadLetter, if not nil, is called with a batch that could not
+	// be delivered after all the retries, and the last error from
+	// the sink function. Sink then carries on with the next batch.
+	// DeadLetter may be called from multiple goroutines at once
+	// if Concurrency is more than 1.
+	DeadLetter func(batch []T, err error)
+
+	// Clock is used to time the backoff. If it is nil,
+	// the real clock is used.
+	Clock clock.Clock
+}
+
+// Sink receives batches from a batcher's out channel, such as the
+// one passed to Start or StartGrouped, and delivers each of them by
+// calling sink, retrying as configured in params. Sink returns nil
+// once batches is closed and every batch has been delivered (or given
+// to params.DeadLetter).
+//
+// If a batch can't be delivered and params.DeadLetter is nil, Sink
+// stops delivering batches and returns the error from sink. If ctx is
+// canceled, Sink returns the context error. In both cases, batches
+// that are in flight may or may not have been delivered, and Sink stops
+// receiving from batches, so the batcher should be stopped as well,
+// for example by canceling its context.
+//
+// The context passed to sink is canceled when Sink is about to return
+// an error.
+func Sink[T any](
+	ctx context.Context, batches <-chan []T,
+	sink func(context.Context, []T) error, params SinkParams[T],
+) error {
+	workers := params.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+
+	if params.Clock == nil {
+		params.Clock = clock.Real{}
+	}
+
+	eg, ctx := errgroup.WithContext(ctx)
+	done := ctx.Done()
+
+	for i := 0; i < workers; i++ {
+		eg.Go(func() error {
+			for {
+				select {
+				case <-done:
+					return ctx.Err()
+				case batch, ok := <-batches:
+					if !ok {
+						return nil
+					}
+
+					err := params.deliver(ctx, batch, sink)
+					if err != nil {
+						return err
+					}
+				}
+			}
+		})
+	}
+
+	return eg.Wait()
+}
+
+// deliver calls sink until it succeeds or the retries run out.
+// It returns a non-nil error if the batch could not be delivered
+// and there is no dead letter callback, or ctx was canceled.
+func (p *SinkParams[T]) deliver(
+	ctx context.Context, batch []T, sink func(context.Context, []T) error,
+) error {
+	backoff := p.InitialBackoff
+	attempts := 0
+
+	var err error
+	for {
+		err = sink(ctx, batch)
+		attempts++
+		if err == nil {
+			return nil
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if attempts > p.Retries {
+			break
+		}
+
+		if backoff > 0 {
+			t := p.Clock.NewTimer(backoff)
+			select {
+			case <-t.C():
+			case <-ctx.Done():
+				t.Stop()
+				return ctx.Err()
+			}
+
+			// without a maximum, doubling would eventually
+			// overflow, and then there would be no backoff at all
+			if backoff <= math.MaxInt64/2 {
+				backoff *= 2
+			}
+			if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+				backoff = p.MaxBackoff
+			}
+		}
+	}
+
+	if p.DeadLetter != nil {
+		p.DeadLetter(batch, err)
+		return nil
+	}
+
+	return fmt.Errorf("sink failed after %d attempts: %w", attempts, err)
+}
@@ -0,0 +1,209 @@
+package batcher
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.lepak.sg/playground/clock"
+	"go.uber.org/goleak"
+)
+
+var errSink = errors.New("sink failed")
+
+func sinkBatches(batches ...[]int) <-chan []int {
+	ch := make(chan []int, len(batches))
+	for _, b := range batches {
+		ch <- b
+	}
+	close(ch)
+	return ch
+}
+
+func TestSink(t *testing.T) {
+	tests := []struct {
+		name string
+		// the sink fails until it has been called this many times
+		// for a batch
+		failures   int
+		retries    int
+		deadLetter bool
+		wantErr    error
+		wantSunk   [][]int
+		wantDead   [][]int
+	}{
+		{
+			name:     "ok",
+			wantSunk: [][]int{{1, 2}, {3}},
+		},
+		{
+			name:     "retry",
+			failures: 2,
+			retries:  2,
+			wantSunk: [][]int{{1, 2}, {3}},
+		},
+		{
+			name:       "dead letter",
+			failures:   2,
+			retries:    1,
+			deadLetter: true,
+			wantDead:   [][]int{{1, 2}, {3}},
+		},
+		{
+			name:     "terminal",
+			failures: 2,
+			retries:  1,
+			wantErr:  errSink,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sunk, dead [][]int
+			calls := make(map[int]int)
+
+			params := SinkParams[int]{
+				Retries:        tt.retries,
+				InitialBackoff: time.Millisecond,
+			}
+			if tt.deadLetter {
+				params.DeadLetter = func(batch []int, err error) {
+					assert.ErrorIs(t, err, errSink)
+					dead = append(dead, batch)
+				}
+			}
+
+			err := Sink(context.Background(), sinkBatches([]int{1, 2}, []int{3}),
+				func(ctx context.Context, batch []int) error {
+					calls[batch[0]]++
+					if calls[batch[0]] <= tt.failures {
+						return errSink
+					}
+					sunk = append(sunk, batch)
+					return nil
+				}, params)
+
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Equal(t, tt.wantSunk, sunk)
+			assert.Equal(t, tt.wantDead, dead)
+			goleak.VerifyNone(t)
+		})
+	}
+}
+
+func TestSink_Backoff(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	calls := make(chan struct{}, 1)
+	errc := make(chan error)
+
+	go func() {
+		errc <- Sink(context.Background(), sinkBatches([]int{1}),
+			func(ctx context.Context, batch []int) error {
+				calls <- struct{}{}
+				return errSink
+			}, SinkParams[int]{
+				Retries:        3,
+				InitialBackoff: time.Second,
+				MaxBackoff:     2 * time.Second,
+				DeadLetter:     func([]int, error) {},
+				Clock:          clk,
+			})
+	}()
+
+	<-calls
+	for _, backoff := range []time.Duration{
+		time.Second, 2 * time.Second, 2 * time.Second,
+	} {
+		clk.WaitTimers(1)
+		clk.Advance(backoff - 1)
+		assert.Len(t, calls, 0, "retried too early")
+		clk.Advance(1)
+		<-calls
+	}
+
+	assert.NoError(t, <-errc)
+	goleak.VerifyNone(t)
+}
+
+func TestSink_BackoffNoMax(t *testing.T) {
+	// enough for the backoff to overflow if it kept doubling
+	const retries = 40
+
+	clk := clock.NewFake(time.Unix(0, 0))
+	calls := make(chan struct{}, 1)
+	errc := make(chan error)
+
+	go func() {
+		errc <- Sink(context.Background(), sinkBatches([]int{1}),
+			func(ctx context.Context, batch []int) error {
+				calls <- struct{}{}
+				return errSink
+			}, SinkParams[int]{
+				Retries:        retries,
+				InitialBackoff: time.Second,
+				DeadLetter:     func([]int, error) {},
+				Clock:          clk,
+			})
+	}()
+
+	<-calls
+	backoff := time.Second
+	for i := 0; i < retries; i++ {
+		clk.WaitTimers(1)
+		clk.Advance(backoff - 1)
+		assert.Len(t, calls, 0, "retried too early")
+		clk.Advance(1)
+		<-calls
+
+		if backoff <= math.MaxInt64/2 {
+			backoff *= 2
+		}
+	}
+
+	assert.NoError(t, <-errc)
+	goleak.VerifyNone(t)
+}
+
+func TestSink_Grouped(t *testing.T) {
+	in := make(chan string, 6)
+	out := make(chan []string)
+
+	for _, s := range []string{
+		"apple", "banana", "cherry", "apricot", "blueberry", "cantaloupe",
+	} {
+		in <- s
+	}
+	close(in)
+
+	var wg sync.WaitGroup
+	StartGrouped(in, out, stringKeyer, &wg, GroupedParams{
+		Params: Params{
+			Threshold: 2,
+			Interval:  time.Second,
+		},
+	})
+
+	var lock sync.Mutex
+	var sunk [][]string
+	err := Sink(context.Background(), out,
+		func(ctx context.Context, batch []string) error {
+			lock.Lock()
+			defer lock.Unlock()
+			sunk = append(sunk, batch)
+			return nil
+		}, SinkParams[string]{
+			Concurrency: 2,
+		})
+
+	wg.Wait()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, [][]string{
+		{"apple", "apricot"},
+		{"banana", "blueberry"},
+		{"cherry", "cantaloupe"},
+	}, sunk)
+	goleak.VerifyNone(t)
+}
@@ -0,0 +1,153 @@
+package batcher
+
+import (
+	"math/bits"
+	"sync/atomic"
+)
+
+// sizeBuckets is the number of buckets in the batch size histogram,
+// enough for any batch size that fits in an int.
+const sizeBuckets = bits.UintSize
+
+// Stats collects statistics from batchers. Pass the same *Stats to
+// any number of batchers through Params.Stats, and read the combined
+// statistics with Snapshot. A grouping batcher also records statistics
+// about its sub-batchers.
+//
+// The zero value is ready to use. Stats is safe for concurrent use.
+type Stats struct {
+	itemsIn    uint64
+	batchesOut uint64
+	sizes      [sizeBuckets]uint64
+	reasons    [FlushManual + 1]uint64
+
+	activeGroups  int64
+	groupsCreated uint64
+	groupsEvicted uint64
+}
+
+// StatsSnapshot is a copy of the statistics in Stats at some point
+// in time. Since the counters are read one by one while batchers are
+// running, they may not be consistent with each other.
+type StatsSnapshot struct {
+	// ItemsIn is the number of items received from in channels.
+	ItemsIn uint64
+	// BatchesOut is the number of batches sent on out channels.
+	BatchesOut uint64
+	// BatchSizes is a histogram of the number of items in each batch.
+	// BatchSizes[i] counts the batches with at least 2^i items
+	// and less than 2^(i+1) items.
+	BatchSizes [sizeBuckets]uint64
+	// Reasons counts the batches sent for each FlushReason.
+	Reasons map[FlushReason]uint64
+
+	// ActiveGroups is the number of sub-batchers running in
+	// grouping batchers, not counting overflow sub-batchers.
+	ActiveGroups int64
+	// GroupsCreated and GroupsEvicted count the sub-batchers that
+	// were created, and that were stopped before their grouping
+	// batcher exited.
+	GroupsCreated uint64
+	GroupsEvicted uint64
+}
+
+// Snapshot returns a copy of the statistics.
+func (s *Stats) Snapshot() StatsSnapshot {
+	snap := StatsSnapshot{
+		ItemsIn:       atomic.LoadUint64(&s.itemsIn),
+		BatchesOut:    atomic.LoadUint64(&s.batchesOut),
+		Reasons:       make(map[FlushReason]uint64, len(s.reasons)),
+		ActiveGroups:  atomic.LoadInt64(&s.activeGroups),
+		GroupsCreated: atomic.LoadUint64(&s.groupsCreated),
+		GroupsEvicted: atomic.LoadUint64(&s.groupsEvicted),
+	}
+
+	for i := range s.sizes {
+		snap.BatchSizes[i] = atomic.LoadUint64(&s.sizes[i])
+	}
+
+	for i := range s.reasons {
+		if n := atomic.LoadUint64(&s.reasons[i]); n > 0 {
+			snap.Reasons[FlushReason(i)] = n
+		}
+	}
+
+	return snap
+}
+
+// Hooks are called when batchers do certain things, so that they can
+// be instrumented by a metrics library. Any of the hooks may be nil.
+// The hooks are called from the batcher goroutines, so they should
+// not block, and they must be safe for concurrent use if the same
+// Hooks are given to more than one batcher.
+type Hooks struct {
+	// OnItem is called when an item is received from in.
+	OnItem func()
+	// OnBatch is called when a batch is about to be sent on out.
+	OnBatch func(size int, reason FlushReason)
+	// OnGroupCreated is called when a grouping batcher creates a
+	// sub-batcher, and OnGroupEvicted is called when it stops one
+	// before it exits.
+	OnGroupCreated func()
+	OnGroupEvicted func()
+	// OnGroupStopped is called when a grouping batcher exits, with
+	// the number of sub-batchers that it stopped, if there were any.
+	// Every sub-batcher created is either evicted or stopped, so the
+	// number running can be tracked with these three hooks.
+	OnGroupStopped func(n int)
+}
+
+// The methods below record into both the Stats, which may be nil,
+// and the Hooks.
+
+func (p *Params) observeItem() {
+	if p.Stats != nil {
+		atomic.AddUint64(&p.Stats.itemsIn, 1)
+	}
+	if p.Hooks.OnItem != nil {
+		p.Hooks.OnItem()
+	}
+}
+
+func (p *Params) observeBatch(size int, reason FlushReason) {
+	if s := p.Stats; s != nil {
+		atomic.AddUint64(&s.batchesOut, 1)
+		// size is always at least 1
+		atomic.AddUint64(&s.sizes[bits.Len(uint(size))-1], 1)
+		atomic.AddUint64(&s.reasons[reason], 1)
+	}
+	if p.Hooks.OnBatch != nil {
+		p.Hooks.OnBatch(size, reason)
+	}
+}
+
+func (p *Params) observeGroupCreated() {
+	if p.Stats != nil {
+		atomic.AddUint64(&p.Stats.groupsCreated, 1)
+		atomic.AddInt64(&p.Stats.activeGroups, 1)
+	}
+	if p.Hooks.OnGroupCreated != nil {
+		p.Hooks.OnGroupCreated()
+	}
+}
+
+func (p *Params) observeGroupEvicted() {
+	if p.Stats != nil {
+		atomic.AddUint64(&p.Stats.groupsEvicted, 1)
+		atomic.AddInt64(&p.Stats.activeGroups, -1)
+	}
+	if p.Hooks.OnGroupEvicted != nil {
+		p.Hooks.OnGroupEvicted()
+	}
+}
+
+// observeGroupsStopped records that n sub-batchers were stopped
+// because their grouping batcher is exiting.
+func (p *Params) observeGroupsStopped(n int) {
+	if p.Stats != nil {
+		atomic.AddInt64(&p.Stats.activeGroups, -int64(n))
+	}
+	if p.Hooks.OnGroupStopped != nil && n > 0 {
+		p.Hooks.OnGroupStopped(n)
+	}
+}
@@ -0,0 +1,97 @@
+package batcher
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+func TestStats(t *testing.T) {
+	in := make(chan int, 7)
+	out := make(chan []int, 3)
+	for i := 0; i < 7; i++ {
+		in <- i
+	}
+	close(in)
+
+	var stats Stats
+	var items, batches int64
+	Batch(in, out, Params{
+		Threshold: 3,
+		Interval:  time.Second,
+		Stats:     &stats,
+		Hooks: Hooks{
+			OnItem: func() { atomic.AddInt64(&items, 1) },
+			OnBatch: func(size int, reason FlushReason) {
+				atomic.AddInt64(&batches, 1)
+			},
+		},
+	})
+
+	snap := stats.Snapshot()
+	assert.EqualValues(t, 7, snap.ItemsIn)
+	assert.EqualValues(t, 3, snap.BatchesOut)
+	assert.EqualValues(t, 1, snap.BatchSizes[0])
+	assert.EqualValues(t, 2, snap.BatchSizes[1])
+	assert.Equal(t, map[FlushReason]uint64{
+		FlushThreshold: 2,
+		FlushClosed:    1,
+	}, snap.Reasons)
+	assert.EqualValues(t, 7, items)
+	assert.EqualValues(t, 3, batches)
+}
+
+func TestStats_Grouped(t *testing.T) {
+	in := make(chan string)
+	out := make(chan []string, 3)
+
+	var stats Stats
+	var created, evicted, stopped int64
+
+	var wg sync.WaitGroup
+	h := NewGrouped(context.Background(), in, out, stringKeyer, &wg,
+		GroupedParams{
+			Params: Params{
+				Threshold: 10,
+				Interval:  time.Hour,
+				Stats:     &stats,
+				Hooks: Hooks{
+					OnGroupCreated: func() { atomic.AddInt64(&created, 1) },
+					OnGroupEvicted: func() { atomic.AddInt64(&evicted, 1) },
+					OnGroupStopped: func(n int) {
+						atomic.AddInt64(&stopped, int64(n))
+					},
+				},
+			},
+			MaxGroups:        1,
+			GroupLimitPolicy: GroupLimitEvictLRU,
+		})
+
+	in <- "apple"
+	in <- "banana"
+	in <- "blueberry"
+	assert.NoError(t, h.Flush(context.Background()))
+	snap := stats.Snapshot()
+	assert.EqualValues(t, 1, snap.ActiveGroups)
+
+	close(in)
+	wg.Wait()
+
+	snap = stats.Snapshot()
+	assert.EqualValues(t, 3, snap.ItemsIn)
+	assert.EqualValues(t, 2, snap.BatchesOut)
+	assert.EqualValues(t, 0, snap.ActiveGroups)
+	assert.EqualValues(t, 2, snap.GroupsCreated)
+	assert.EqualValues(t, 1, snap.GroupsEvicted)
+	assert.EqualValues(t, 2, created)
+	assert.EqualValues(t, 1, evicted)
+	assert.EqualValues(t, 1, stopped)
+	// what a metrics adapter would track
+	assert.EqualValues(t, snap.ActiveGroups, created-evicted-stopped)
+	goleak.VerifyNone(t)
+}
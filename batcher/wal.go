@@ -0,0 +1,418 @@
+package batcher
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Encoder converts items to and from bytes, so that they can be
+// written to a WAL.
+type Encoder[T any] interface {
+	Encode(T) ([]byte, error)
+	Decode([]byte) (T, error)
+}
+
+// JSONEncoder is an Encoder that uses encoding/json.
+type JSONEncoder[T any] struct{}
+
+func (JSONEncoder[T]) Encode(item T) ([]byte, error) {
+	return json.Marshal(item)
+}
+
+func (JSONEncoder[T]) Decode(b []byte) (T, error) {
+	var item T
+	err := json.Unmarshal(b, &item)
+	return item, err
+}
+
+type WALParams[T any] struct {
+	// Encoder serializes items. If it is nil, JSONEncoder is used.
+	Encoder Encoder[T]
+
+	// SegmentSize is the size in bytes at which a segment file is
+	// closed and a new one is started. A segment file is deleted once
+	// every item in it has been acknowledged, so this limits how much
+	// disk space is used by items that were already sent.
+	// If this is 0, 64 MiB is used.
+	SegmentSize int64
+
+	// Sync makes the WAL call fsync after writing each record.
+	// Without it, items survive a crash of the process, but not
+	// necessarily a crash of the machine.
+	Sync bool
+}
+
+// WAL is a write-ahead log of the items received by a durable batcher.
+// It is made of segment files in a directory. Every item is appended
+// to the newest segment file when it is received, and every batch is
+// acknowledged once it has been sent on the out channel. When the WAL
+// is opened again, the items that were never acknowledged are sent
+// again, before any new items.
+//
+// A WAL may only be used by one batcher, and only once.
+type WAL[T any] struct {
+	dir    string
+	params WALParams[T]
+
+	// segments are ordered by base, the last one is being written
+	segments []walSegment
+	f        *os.File
+	size     int64 // of f
+
+	next    uint64 // seq of the next item to be appended
+	ackNext uint64 // seq of the oldest item that is not acknowledged
+
+	// unacknowledged items found by OpenWAL,
+	// handed to the batcher by replay
+	pending []T
+
+	buf []byte // reused to build records
+}
+
+type walSegment struct {
+	base  uint64 // seq of the first item in the segment
+	count uint64 // number of items in the segment
+}
+
+const (
+	walItem byte = iota + 1
+	walAck
+)
+
+const walSuffix = ".wal"
+
+// OpenWAL opens the WAL in dir, creating dir if needed, and reads any
+// items that were not acknowledged. If the last segment file ends with
+// a partial record, which can happen if the process crashed while
+// writing it, the partial record is discarded.
+func OpenWAL[T any](dir string, params WALParams[T]) (*WAL[T], error) {
+	if params.Encoder == nil {
+		params.Encoder = JSONEncoder[T]{}
+	}
+	if params.SegmentSize <= 0 {
+		params.SegmentSize = 64 << 20
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &WAL[T]{
+		dir:    dir,
+		params: params,
+	}
+
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, walSuffix) {
+			continue
+		}
+		base, err := strconv.ParseUint(
+			strings.TrimSuffix(name, walSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		w.segments = append(w.segments, walSegment{base: base})
+	}
+	sort.Slice(w.segments, func(i, j int) bool {
+		return w.segments[i].base < w.segments[j].base
+	})
+
+	if len(w.segments) == 0 {
+		if err := w.rotate(); err != nil {
+			return nil, err
+		}
+		return w, nil
+	}
+
+	// items in deleted segments were all acknowledged
+	w.ackNext = w.segments[0].base
+
+	var items []T
+	for i := range w.segments {
+		last := i == len(w.segments)-1
+		items, err = w.load(&w.segments[i], items, last)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// items[0] has the seq of the first segment's base
+	start := w.ackNext - w.segments[0].base
+	if start < uint64(len(items)) {
+		w.pending = items[start:]
+	}
+
+	seg := w.segments[len(w.segments)-1]
+	w.next = seg.base + seg.count
+	w.f, err = os.OpenFile(w.path(seg.base), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return nil, err
+	}
+	info, err := w.f.Stat()
+	if err != nil {
+		w.f.Close()
+		return nil, err
+	}
+	w.size = info.Size()
+
+	return w, nil
+}
+
+// load reads every record in seg, appending the items to items.
+// If last is true, a partial or corrupt record at the end of
+// the segment file is truncated, otherwise it's an error.
+func (w *WAL[T]) load(seg *walSegment, items []T, last bool) ([]T, error) {
+	path := w.path(seg.base)
+	f, err := os.Open(path)
+	if err != nil {
+		return items, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var good int64 // offset after the last good record
+	for {
+		kind, payload, n, err := readRecord(r)
+		if err == io.EOF {
+			return items, nil
+		} else if err != nil {
+			if !last {
+				return items, fmt.Errorf("wal segment %s: %w", path, err)
+			}
+			// the process probably crashed while writing this
+			return items, os.Truncate(path, good)
+		}
+		good += n
+
+		switch kind {
+		case walItem:
+			item, err := w.params.Encoder.Decode(payload)
+			if err != nil {
+				return items, fmt.Errorf("wal segment %s: %w", path, err)
+			}
+			items = append(items, item)
+			seg.count++
+		case walAck:
+			ackNext, _ := binary.Uvarint(payload)
+			if ackNext > w.ackNext {
+				w.ackNext = ackNext
+			}
+		}
+	}
+}
+
+var errCorruptRecord = errors.New("corrupt record")
+
+// readRecord reads one record, and returns its kind, its payload and
+// the number of bytes read. It returns io.EOF only if there are no
+// more records at all.
+//
+// A record is the kind byte, the payload length as a uvarint, the
+// payload, then the CRC-32 of the kind and payload.
+func readRecord(r *bufio.Reader) (byte, []byte, int64, error) {
+	kind, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, 0, err
+	}
+	if kind != walItem && kind != walAck {
+		return 0, nil, 0, errCorruptRecord
+	}
+
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, nil, 0, errCorruptRecord
+	}
+	if length > 1<<30 {
+		return 0, nil, 0, errCorruptRecord
+	}
+
+	payload := make([]byte, length+4)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, 0, errCorruptRecord
+	}
+	sum := binary.BigEndian.Uint32(payload[length:])
+	payload = payload[:length]
+
+	crc := crc32.Update(crc32.ChecksumIEEE([]byte{kind}),
+		crc32.IEEETable, payload)
+	if crc != sum {
+		return 0, nil, 0, errCorruptRecord
+	}
+
+	n := 1 + int64(uvarintLen(length)) + int64(length) + 4
+	return kind, payload, n, nil
+}
+
+func uvarintLen(x uint64) int {
+	var buf [binary.MaxVarintLen64]byte
+	return binary.PutUvarint(buf[:], x)
+}
+
+func (w *WAL[T]) path(base uint64) string {
+	return filepath.Join(w.dir, fmt.Sprintf("%020d%s", base, walSuffix))
+}
+
+// Pending returns the number of items that were not acknowledged
+// when the WAL was opened, and have not been handed to a batcher yet.
+func (w *WAL[T]) Pending() int {
+	return len(w.pending)
+}
+
+// replay returns the pending items, then forgets them.
+func (w *WAL[T]) replay() []T {
+	p := w.pending
+	w.pending = nil
+	return p
+}
+
+// append writes item to the newest segment file.
+func (w *WAL[T]) append(item T) error {
+	// a segment with no items can't be replaced by a new one with
+	// the same base, but it's only filled with acks after a replay
+	if w.size >= w.params.SegmentSize &&
+		w.segments[len(w.segments)-1].count > 0 {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+
+	payload, err := w.params.Encoder.Encode(item)
+	if err != nil {
+		return err
+	}
+	if err := w.write(walItem, payload); err != nil {
+		return err
+	}
+
+	w.segments[len(w.segments)-1].count++
+	w.next++
+	return nil
+}
+
+// ack acknowledges the n oldest unacknowledged items.
+func (w *WAL[T]) ack(n int) error {
+	w.ackNext += uint64(n)
+
+	var payload [binary.MaxVarintLen64]byte
+	l := binary.PutUvarint(payload[:], w.ackNext)
+	if err := w.write(walAck, payload[:l]); err != nil {
+		return err
+	}
+	return w.prune()
+}
+
+// prune deletes segment files that only have acknowledged items.
+func (w *WAL[T]) prune() error {
+	// never delete the segment being written
+	for len(w.segments) > 1 {
+		seg := w.segments[0]
+		if seg.base+seg.count > w.ackNext {
+			break
+		}
+		if err := os.Remove(w.path(seg.base)); err != nil {
+			return err
+		}
+		w.segments = w.segments[1:]
+	}
+	return nil
+}
+
+func (w *WAL[T]) write(kind byte, payload []byte) error {
+	var hdr [1 + binary.MaxVarintLen64]byte
+	hdr[0] = kind
+	l := 1 + binary.PutUvarint(hdr[1:], uint64(len(payload)))
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc32.Update(
+		crc32.ChecksumIEEE(hdr[:1]), crc32.IEEETable, payload))
+
+	w.buf = append(w.buf[:0], hdr[:l]...)
+	w.buf = append(w.buf, payload...)
+	w.buf = append(w.buf, sum[:]...)
+
+	n, err := w.f.Write(w.buf)
+	w.size += int64(n)
+	if err != nil {
+		return err
+	}
+	if w.params.Sync {
+		return w.f.Sync()
+	}
+	return nil
+}
+
+// rotate closes the current segment file, if any,
+// and starts a new one. Older segments may be deleted.
+func (w *WAL[T]) rotate() error {
+	if w.f != nil {
+		if err := w.f.Close(); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(w.path(w.next),
+		os.O_WRONLY|os.O_APPEND|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	w.f = f
+	w.size = 0
+	w.segments = append(w.segments, walSegment{base: w.next})
+	return w.prune()
+}
+
+// Close closes the current segment file. It must not be called
+// before the batcher using the WAL has exited.
+func (w *WAL[T]) Close() error {
+	return w.f.Close()
+}
+
+// BatchDurable is like BatchContext, but every item is written to wal
+// as soon as it is received, and every batch is acknowledged in wal
+// once it has been sent on out. Items that were not acknowledged when
+// wal was opened, e.g. because the process crashed, are received
+// before any items from in, so they are sent in the first batches.
+//
+// Batches are sent at least once: if the process crashes after a batch
+// is sent but before it is acknowledged, it will be sent again. If
+// params.DropOnCancel is true, the items of a partial batch discarded
+// on cancellation are sent again when wal is next opened.
+//
+// If an item can't be written to wal, or a batch can't be
+// acknowledged, BatchDurable closes out and returns the error.
+// The partial batch is not sent, but it is already in wal.
+// wal must be closed by the caller after BatchDurable returns.
+func BatchDurable[T any](
+	ctx context.Context, in <-chan T, out chan<- []T, wal *WAL[T],
+	params Params,
+) error {
+	defer close(out)
+	return batch(ctx, in, out, items[T], nil, batchExt[T]{wal: wal}, params)
+}
+
+// NewDurable starts a durable batcher, like BatchDurable,
+// and returns its Handle. wal must be closed by the caller
+// after the batcher exits.
+func NewDurable[T any](
+	ctx context.Context, in <-chan T, out chan<- []T, wal *WAL[T],
+	wg *sync.WaitGroup, params Params,
+) *Handle {
+	return start(ctx, in, out, items[T], batchExt[T]{wal: wal}, wg, params)
+}
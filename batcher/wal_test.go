@@ -0,0 +1,154 @@
+package batcher
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+
+	"go.lepak.sg/playground/testutils"
+)
+
+type intEncoder struct{}
+
+func (intEncoder) Encode(i int) ([]byte, error) {
+	return []byte(strconv.Itoa(i)), nil
+}
+
+func (intEncoder) Decode(b []byte) (int, error) {
+	return strconv.Atoi(string(b))
+}
+
+// crashDurable simulates a crash: items are sent to a durable batcher
+// with the given threshold, then it is canceled without sending its
+// partial batch. The batches that were sent are returned.
+func crashDurable(
+	t *testing.T, dir string, params WALParams[int], threshold int,
+	items ...int,
+) [][]int {
+	wal, err := OpenWAL(dir, params)
+	require.NoError(t, err)
+
+	in := make(chan int)
+	out := make(chan []int, len(items))
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var wg sync.WaitGroup
+	h := NewDurable(ctx, in, out, wal, &wg, Params{
+		Threshold:    threshold,
+		Interval:     time.Hour,
+		DropOnCancel: true,
+	})
+	for _, item := range items {
+		in <- item
+	}
+	cancel()
+	wg.Wait()
+	assert.ErrorIs(t, h.Wait(), context.Canceled)
+	assert.NoError(t, wal.Close())
+
+	var sent [][]int
+	for batch := range out {
+		sent = append(sent, batch)
+	}
+	return sent
+}
+
+func TestBatchDurable(t *testing.T) {
+	dir := t.TempDir()
+
+	sent := crashDurable(t, dir, WALParams[int]{}, 2, 1, 2, 3)
+	assert.Equal(t, [][]int{{1, 2}}, sent)
+
+	wal, err := OpenWAL(dir, WALParams[int]{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, wal.Pending())
+
+	in := make(chan int, 3)
+	out := make(chan []int, 3)
+	in <- 4
+	in <- 5
+	in <- 6
+	close(in)
+
+	err = BatchDurable(context.Background(), in, out, wal, Params{
+		Threshold: 3,
+		Interval:  time.Hour,
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, wal.Close())
+	testutils.Drain(t, [][]int{{3, 4, 5}, {6}}, out)
+
+	// everything was acknowledged
+	wal, err = OpenWAL(dir, WALParams[int]{})
+	require.NoError(t, err)
+	assert.Equal(t, 0, wal.Pending())
+	assert.NoError(t, wal.Close())
+
+	goleak.VerifyNone(t)
+}
+
+func TestOpenWAL_TornRecord(t *testing.T) {
+	dir := t.TempDir()
+	params := WALParams[int]{Encoder: intEncoder{}}
+
+	sent := crashDurable(t, dir, params, 10, 1, 2)
+	assert.Empty(t, sent)
+
+	// a partial item record
+	path := filepath.Join(dir, "00000000000000000000.wal")
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = f.Write([]byte{walItem, 5, '1'})
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	wal, err := OpenWAL(dir, params)
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, wal.pending)
+
+	in := make(chan int, 1)
+	out := make(chan []int, 1)
+	in <- 3
+	close(in)
+	err = BatchDurable(context.Background(), in, out, wal, Params{
+		Threshold: 10,
+		Interval:  time.Hour,
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, wal.Close())
+	testutils.Drain(t, [][]int{{1, 2, 3}}, out)
+}
+
+func TestWAL_Segments(t *testing.T) {
+	dir := t.TempDir()
+	// every item goes into a new segment
+	params := WALParams[int]{Encoder: intEncoder{}, SegmentSize: 1}
+
+	sent := crashDurable(t, dir, params, 2, 1, 2, 3, 4, 5)
+	assert.Equal(t, [][]int{{1, 2}, {3, 4}}, sent)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	// segments with only acknowledged items were deleted,
+	// except the one being written
+	assert.Equal(t, []string{
+		"00000000000000000004.wal",
+	}, names)
+
+	wal, err := OpenWAL(dir, params)
+	require.NoError(t, err)
+	assert.Equal(t, []int{5}, wal.pending)
+	assert.NoError(t, wal.Close())
+}
@@ -0,0 +1,237 @@
+package chops
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrBroadcasterClosed is returned by Publish after Close is called.
+var ErrBroadcasterClosed = errors.New("chops: broadcaster is closed")
+
+// SlowPolicy decides what a Broadcaster does when a subscriber's
+// buffer is full.
+type SlowPolicy int
+
+const (
+	// Publish waits until the subscriber receives the element,
+	// so the slowest subscriber limits the rate of every subscriber.
+	SlowBlock SlowPolicy = iota
+	// The subscriber misses the element.
+	SlowDrop
+	// The subscriber is unsubscribed, so its channel is closed.
+	SlowDisconnect
+)
+
+// Broadcaster sends every element published to it to each of its
+// subscribers. Every subscriber receives the elements in the order
+// they were published. The zero value is not usable, call
+// NewBroadcaster instead.
+type Broadcaster[T any] struct {
+	// pubMu is held by Publish, so that elements are
+	// published one at a time
+	pubMu sync.Mutex
+
+	// mu protects subs and closed. It is never held while sending,
+	// so a slow subscriber doesn't hold up Subscribe and Unsubscribe
+	mu     sync.Mutex
+	subs   map[*Subscription[T]]struct{}
+	closed bool
+
+	// done is closed by Close, to stop a Publish that is blocked
+	done     chan struct{}
+	doneOnce sync.Once
+}
+
+// Subscription is a subscriber of a Broadcaster.
+type Subscription[T any] struct {
+	ch     chan T
+	policy SlowPolicy
+
+	// mu protects sends on ch and closing it
+	mu     sync.Mutex
+	closed bool
+
+	// done is closed before mu is taken to close ch,
+	// to stop a Publish that is blocked on this subscriber
+	done     chan struct{}
+	doneOnce sync.Once
+}
+
+// C returns the channel that elements are received from. It is closed
+// once the subscriber is unsubscribed, or the Broadcaster is closed.
+func (s *Subscription[T]) C() <-chan T {
+	return s.ch
+}
+
+func (s *Subscription[T]) stop() {
+	s.doneOnce.Do(func() { close(s.done) })
+}
+
+// close stops the subscriber and closes its channel.
+// It may be called more than once.
+func (s *Subscription[T]) close() {
+	s.stop()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closeLocked()
+}
+
+// closeLocked must be called with mu held.
+func (s *Subscription[T]) closeLocked() {
+	if !s.closed {
+		s.closed = true
+		close(s.ch)
+	}
+}
+
+// NewBroadcaster makes a Broadcaster with no subscribers.
+func NewBroadcaster[T any]() *Broadcaster[T] {
+	return &Broadcaster[T]{
+		subs: make(map[*Subscription[T]]struct{}),
+		done: make(chan struct{}),
+	}
+}
+
+// Subscribe adds a subscriber whose channel has the given buffer size.
+// policy decides what happens when the buffer is full. The subscriber
+// only receives elements published after Subscribe returns. If the
+// Broadcaster is closed, the subscriber's channel is already closed.
+func (b *Broadcaster[T]) Subscribe(buffer int, policy SlowPolicy) *Subscription[T] {
+	s := &Subscription[T]{
+		ch:     make(chan T, buffer),
+		policy: policy,
+		done:   make(chan struct{}),
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		s.close()
+		return s
+	}
+	b.subs[s] = struct{}{}
+	return s
+}
+
+// Unsubscribe removes a subscriber and closes its channel. It does
+// nothing if the subscriber was already removed. The subscriber may
+// stop receiving before calling Unsubscribe, even with SlowBlock.
+func (b *Broadcaster[T]) Unsubscribe(s *Subscription[T]) {
+	b.mu.Lock()
+	delete(b.subs, s)
+	b.mu.Unlock()
+
+	s.close()
+}
+
+// Publish sends x to every subscriber. It returns once every
+// subscriber has x in its buffer, missed it according to its policy,
+// or was unsubscribed. If ctx is canceled first, Publish returns the
+// context error, and some subscribers may not receive x. If the
+// Broadcaster is closed, Publish returns ErrBroadcasterClosed.
+func (b *Broadcaster[T]) Publish(ctx context.Context, x T) error {
+	b.pubMu.Lock()
+	defer b.pubMu.Unlock()
+
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return ErrBroadcasterClosed
+	}
+	subs := make([]*Subscription[T], 0, len(b.subs))
+	for s := range b.subs {
+		subs = append(subs, s)
+	}
+	b.mu.Unlock()
+
+	// subscribers with SlowBlock that couldn't receive right away
+	var blocked []*Subscription[T]
+
+	for _, s := range subs {
+		if !b.trySend(s, x) {
+			blocked = append(blocked, s)
+		}
+	}
+
+	for _, s := range blocked {
+		if err := b.send(ctx, s, x); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// trySend sends x to s without blocking, applying the policy of s
+// if its buffer is full. It returns false if Publish should wait
+// for s to receive x.
+func (b *Broadcaster[T]) trySend(s *Subscription[T], x T) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return true
+	}
+
+	select {
+	case s.ch <- x:
+		return true
+	default:
+	}
+
+	switch s.policy {
+	case SlowBlock:
+		return false
+	case SlowDrop:
+	case SlowDisconnect:
+		s.stop()
+		s.closeLocked()
+		b.mu.Lock()
+		delete(b.subs, s)
+		b.mu.Unlock()
+	default:
+		panic("invalid SlowPolicy")
+	}
+	return true
+}
+
+// send waits for s to receive x.
+func (b *Broadcaster[T]) send(ctx context.Context, s *Subscription[T], x T) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+
+	select {
+	case s.ch <- x:
+	case <-s.done:
+		// Unsubscribe is waiting for s.mu
+	case <-b.done:
+		return ErrBroadcasterClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return nil
+}
+
+// Close unsubscribes every subscriber, closing their channels.
+// A Publish that is blocked, and every later Publish, returns
+// ErrBroadcasterClosed. Close may be called more than once.
+func (b *Broadcaster[T]) Close() {
+	b.doneOnce.Do(func() { close(b.done) })
+
+	b.mu.Lock()
+	b.closed = true
+	subs := b.subs
+	b.subs = make(map[*Subscription[T]]struct{})
+	b.mu.Unlock()
+
+	for s := range subs {
+		s.close()
+	}
+}
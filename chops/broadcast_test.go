@@ -0,0 +1,149 @@
+package chops
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+func TestBroadcaster(t *testing.T) {
+	b := NewBroadcaster[int]()
+	s1 := b.Subscribe(2, SlowBlock)
+	s2 := b.Subscribe(2, SlowBlock)
+
+	assert.NoError(t, b.Publish(context.Background(), 1))
+	b.Unsubscribe(s1)
+	b.Unsubscribe(s1) // no-op
+	assert.NoError(t, b.Publish(context.Background(), 2))
+
+	assert.Equal(t, []int{1}, collect(s1.C()))
+
+	b.Close()
+	assert.Equal(t, []int{1, 2}, collect(s2.C()))
+	assert.ErrorIs(t, b.Publish(context.Background(), 3), ErrBroadcasterClosed)
+
+	s3 := b.Subscribe(1, SlowBlock)
+	_, stat := TryRecv(s3.C()).Get()
+	assert.Equal(t, Closed, stat)
+	b.Close()
+}
+
+func TestBroadcaster_SlowPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy SlowPolicy
+		want   []int
+		closed bool
+	}{
+		{"drop", SlowDrop, []int{1}, false},
+		{"disconnect", SlowDisconnect, []int{1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBroadcaster[int]()
+			slow := b.Subscribe(1, tt.policy)
+			fast := b.Subscribe(3, tt.policy)
+
+			for i := 1; i <= 3; i++ {
+				assert.NoError(t, b.Publish(context.Background(), i))
+			}
+
+			if tt.closed {
+				assert.Equal(t, tt.want, collect(slow.C()))
+			} else {
+				x, stat := TryRecv(slow.C()).Get()
+				assert.Equal(t, Ok, stat)
+				assert.Equal(t, tt.want, []int{x})
+				_, stat = TryRecv(slow.C()).Get()
+				assert.Equal(t, Blocked, stat)
+			}
+
+			b.Close()
+			assert.Equal(t, []int{1, 2, 3}, collect(fast.C()))
+		})
+	}
+}
+
+func TestBroadcaster_Block(t *testing.T) {
+	b := NewBroadcaster[int]()
+	s := b.Subscribe(0, SlowBlock)
+
+	errc := make(chan error)
+	go func() {
+		errc <- b.Publish(context.Background(), 1)
+	}()
+	assert.Equal(t, 1, <-s.C())
+	assert.NoError(t, <-errc)
+
+	// unblocked by Unsubscribe
+	go func() {
+		errc <- b.Publish(context.Background(), 2)
+	}()
+	b.Unsubscribe(s)
+	assert.NoError(t, <-errc)
+
+	// unblocked by ctx
+	s = b.Subscribe(0, SlowBlock)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		errc <- b.Publish(ctx, 3)
+	}()
+	cancel()
+	assert.ErrorIs(t, <-errc, context.Canceled)
+
+	// unblocked by Close
+	go func() {
+		errc <- b.Publish(context.Background(), 4)
+	}()
+	b.Close()
+	assert.ErrorIs(t, <-errc, ErrBroadcasterClosed)
+	_, ok := <-s.C()
+	assert.False(t, ok)
+
+	goleak.VerifyNone(t)
+}
+
+func TestBroadcaster_SubscribeWhileBlocked(t *testing.T) {
+	b := NewBroadcaster[int]()
+	slow := b.Subscribe(0, SlowBlock)
+	other := b.Subscribe(1, SlowBlock)
+
+	errc := make(chan error)
+	go func() {
+		errc <- b.Publish(context.Background(), 1)
+	}()
+	// other receives 1 before Publish blocks on slow
+	assert.Equal(t, 1, <-other.C())
+	// let Publish block
+	time.Sleep(10 * time.Millisecond)
+
+	subscribed := make(chan *Subscription[int])
+	go func() {
+		s := b.Subscribe(1, SlowBlock)
+		b.Unsubscribe(other)
+		subscribed <- s
+	}()
+
+	var s *Subscription[int]
+	select {
+	case s = <-subscribed:
+	case <-time.After(time.Second):
+		t.Fatal("Subscribe blocked behind Publish")
+	}
+	_, ok := <-other.C()
+	assert.False(t, ok)
+
+	assert.Equal(t, 1, <-slow.C())
+	assert.NoError(t, <-errc)
+
+	// s was subscribed after Publish started, so it misses 1
+	b.Unsubscribe(slow)
+	assert.NoError(t, b.Publish(context.Background(), 2))
+	b.Close()
+	assert.Equal(t, []int{2}, collect(s.C()))
+
+	goleak.VerifyNone(t)
+}
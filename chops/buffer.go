@@ -0,0 +1,237 @@
+package chops
+
+import "sync"
+
+// queue is a FIFO queue backed by a ring buffer that grows as needed.
+type queue[T any] struct {
+	buf        []T
+	head, size int
+}
+
+func (q *queue[T]) len() int {
+	return q.size
+}
+
+func (q *queue[T]) push(x T) {
+	if q.size == len(q.buf) {
+		n := 2 * len(q.buf)
+		if n == 0 {
+			n = 16
+		}
+		buf := make([]T, n)
+		// unwrap the ring so that head is at 0
+		copied := copy(buf, q.buf[q.head:])
+		copy(buf[copied:], q.buf[:q.head])
+		q.buf, q.head = buf, 0
+	}
+	q.buf[(q.head+q.size)%len(q.buf)] = x
+	q.size++
+}
+
+func (q *queue[T]) front() T {
+	return q.buf[q.head]
+}
+
+func (q *queue[T]) pop() T {
+	x := q.buf[q.head]
+	q.buf[q.head] = *new(T) // don't keep it alive
+	q.head = (q.head + 1) % len(q.buf)
+	q.size--
+	return x
+}
+
+// RingPolicy decides which element a Ring drops when it is full.
+type RingPolicy int
+
+const (
+	// The oldest element in the Ring is dropped to make room
+	// for the new one.
+	DropOldest RingPolicy = iota
+	// The new element is dropped.
+	DropNewest
+)
+
+// inCap is the capacity of In, so that sends on In don't have to wait
+// for the goroutine that drains it to be scheduled.
+const inCap = 64
+
+// buffer moves elements from in to out through a queue, so that
+// sends on in don't have to wait for receives on out. If limit
+// is positive, the queue holds at most limit elements, and policy
+// decides what to drop when it is full.
+//
+// One goroutine drains in into the queue, and another offers the
+// front of the queue on out, so that draining never waits for a
+// receiver.
+type buffer[T any] struct {
+	in  chan T
+	out chan T
+	// notify wakes up the out goroutine after a push or close
+	notify chan struct{}
+
+	// mu protects everything below
+	mu     sync.Mutex
+	q      queue[T]
+	limit  int
+	policy RingPolicy
+	closed bool
+	drops  uint64
+	// the number of elements removed from the front of q,
+	// so run can tell if the element it's sending was dropped
+	popped uint64
+}
+
+func newBuffer[T any](limit int, policy RingPolicy) *buffer[T] {
+	b := &buffer[T]{
+		in:     make(chan T, inCap),
+		out:    make(chan T),
+		notify: make(chan struct{}, 1),
+		limit:  limit,
+		policy: policy,
+	}
+	go b.drain()
+	go b.run()
+	return b
+}
+
+func (b *buffer[T]) wake() {
+	select {
+	case b.notify <- struct{}{}:
+	default:
+	}
+}
+
+// drain moves elements from in to the queue until in is closed.
+func (b *buffer[T]) drain() {
+	for x := range b.in {
+		b.mu.Lock()
+		b.push(x)
+		b.mu.Unlock()
+		b.wake()
+	}
+
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+	b.wake()
+}
+
+// run sends elements from the queue on out, then closes out
+// once the queue is empty and in is closed.
+func (b *buffer[T]) run() {
+	defer close(b.out)
+
+	for {
+		b.mu.Lock()
+		if b.q.len() == 0 {
+			closed := b.closed
+			b.mu.Unlock()
+			if closed {
+				return
+			}
+			<-b.notify
+			continue
+		}
+		next, seq := b.q.front(), b.popped
+		b.mu.Unlock()
+
+		select {
+		case b.out <- next:
+			b.mu.Lock()
+			if b.popped == seq {
+				b.q.pop()
+				b.popped++
+			} else {
+				// it was dropped while being sent,
+				// so it wasn't really dropped
+				b.drops--
+			}
+			b.mu.Unlock()
+		case <-b.notify:
+		}
+	}
+}
+
+// push must be called with mu held.
+func (b *buffer[T]) push(x T) {
+	if b.limit > 0 && b.q.len() >= b.limit {
+		b.drops++
+		if b.policy == DropNewest {
+			return
+		}
+		b.q.pop()
+		b.popped++
+	}
+	b.q.push(x)
+}
+
+// Unbounded is like a channel with a buffer that grows without limit,
+// so sends never wait for receives. Send elements on In, and receive
+// them from Out in the same order. Close In when done: Out is closed
+// after every element has been received from it.
+//
+// Unbounded has goroutines that move elements from In to Out. They
+// exit once In is closed and Out is drained, so Out should be drained
+// even if the elements are no longer needed.
+//
+// In has a small buffer, which one of the goroutines empties as soon as
+// it can, without waiting for receives on Out. So TrySend on In only
+// returns Blocked if that goroutine has fallen behind, and then not
+// for long.
+type Unbounded[T any] struct {
+	b *buffer[T]
+}
+
+// NewUnbounded makes an Unbounded and starts its goroutines.
+func NewUnbounded[T any]() *Unbounded[T] {
+	return &Unbounded[T]{b: newBuffer[T](0, DropOldest)}
+}
+
+// In returns the channel to send on.
+func (u *Unbounded[T]) In() chan<- T {
+	return u.b.in
+}
+
+// Out returns the channel to receive from.
+func (u *Unbounded[T]) Out() <-chan T {
+	return u.b.out
+}
+
+// Ring is like Unbounded, but it holds at most a fixed number of
+// elements. When it is full, an element is dropped according to its
+// RingPolicy, and the number of dropped elements is counted. Elements
+// that are still in the buffer of In are not counted towards the size,
+// since they haven't reached the Ring yet.
+//
+// The oldest element is offered on Out until it is received. If that
+// element is dropped while it is offered, a receiver may still get it,
+// and then it isn't counted as dropped.
+type Ring[T any] struct {
+	b *buffer[T]
+}
+
+// NewRing makes a Ring with the given size and starts its goroutines.
+// It panics if size is not positive.
+func NewRing[T any](size int, policy RingPolicy) *Ring[T] {
+	if size <= 0 {
+		panic("invalid size")
+	}
+	return &Ring[T]{b: newBuffer[T](size, policy)}
+}
+
+// In returns the channel to send on.
+func (r *Ring[T]) In() chan<- T {
+	return r.b.in
+}
+
+// Out returns the channel to receive from.
+func (r *Ring[T]) Out() <-chan T {
+	return r.b.out
+}
+
+// Drops returns the number of elements dropped so far.
+func (r *Ring[T]) Drops() uint64 {
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	return r.b.drops
+}
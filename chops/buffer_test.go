@@ -0,0 +1,136 @@
+package chops
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+func TestQueue(t *testing.T) {
+	var q queue[int]
+	var want []int
+
+	// push two, pop one, so the ring wraps around while growing
+	for i := 0; i < 100; i++ {
+		q.push(2 * i)
+		q.push(2*i + 1)
+		want = append(want, 2*i, 2*i+1)
+
+		assert.Equal(t, want[0], q.front())
+		assert.Equal(t, want[0], q.pop())
+		want = want[1:]
+	}
+
+	assert.Equal(t, len(want), q.len())
+	for _, x := range want {
+		assert.Equal(t, x, q.pop())
+	}
+	assert.Equal(t, 0, q.len())
+}
+
+func TestUnbounded(t *testing.T) {
+	const n = 1000
+	u := NewUnbounded[int]()
+
+	// nobody is receiving yet
+	for i := 0; i < n; i++ {
+		u.In() <- i
+	}
+	assert.True(t, TryClose(u.In()))
+	assert.False(t, TryClose(u.In()))
+	assert.Equal(t, Closed, TrySend(u.In(), n))
+
+	got := collect(u.Out())
+	assert.Len(t, got, n)
+	for i, x := range got {
+		assert.Equal(t, i, x)
+	}
+
+	_, stat := TryRecv(u.Out()).Get()
+	assert.Equal(t, Closed, stat)
+	goleak.VerifyNone(t)
+}
+
+func TestRing(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy RingPolicy
+		want   []int
+	}{
+		{"drop oldest", DropOldest, []int{3, 4, 5}},
+		{"drop newest", DropNewest, []int{1, 2, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRing[int](3, tt.policy)
+			for i := 1; i <= 5; i++ {
+				assert.Equal(t, Ok, TrySend(r.In(), i))
+			}
+			close(r.In())
+
+			// an element that was dropped while it was
+			// offered on Out may still be received
+			got := collect(r.Out())
+			assert.LessOrEqual(t, len(got), len(tt.want)+1)
+			assert.Equal(t, tt.want, got[len(got)-len(tt.want):])
+			assert.Equal(t, uint64(5-len(got)), r.Drops())
+			goleak.VerifyNone(t)
+		})
+	}
+}
+
+func TestRing_TrySend(t *testing.T) {
+	const n = 10000
+	r := NewRing[int](1000, DropOldest)
+
+	// the buffer of In is empty, so these can't be Blocked
+	for i := 0; i < cap(r.In()); i++ {
+		assert.Equal(t, Ok, TrySend(r.In(), i))
+	}
+	// after that, TrySend may be Blocked while In is drained,
+	// but In is drained even though nobody is receiving
+	for i := cap(r.In()); i < n; i++ {
+		for TrySend(r.In(), i) == Blocked {
+			runtime.Gosched()
+		}
+	}
+	close(r.In())
+
+	got := collect(r.Out())
+	// more may get through if In is still being drained
+	// while they are received
+	assert.GreaterOrEqual(t, len(got), 1000)
+	assert.Equal(t, n-1, got[len(got)-1])
+	assert.Equal(t, uint64(n-len(got)), r.Drops())
+	goleak.VerifyNone(t)
+}
+
+func TestRing_ReceiveWhileSending(t *testing.T) {
+	const n = 10000
+	r := NewRing[int](10, DropOldest)
+
+	done := make(chan []int)
+	go func() {
+		done <- collect(r.Out())
+	}()
+	for i := 0; i < n; i++ {
+		r.In() <- i
+	}
+	close(r.In())
+
+	got := <-done
+	assert.Equal(t, uint64(n-len(got)), r.Drops())
+	for i := 1; i < len(got); i++ {
+		assert.Less(t, got[i-1], got[i])
+	}
+	assert.Equal(t, n-1, got[len(got)-1])
+	goleak.VerifyNone(t)
+}
+
+func TestRing_Panic(t *testing.T) {
+	assert.PanicsWithValue(t, "invalid size", func() {
+		NewRing[int](0, DropOldest)
+	})
+}
@@ -1,15 +1,13 @@
 // Package chops provides useful channel operations
 // that are not provided by the standard `<-` mechanism.
-// It is not guaranteed to be compatible with all versions
-// of Go, although it is tested on Go 1.18.
+// IsClosed depends on the runtime's channel layout, which is only
+// known for some versions of Go; see IsClosed for details.
 package chops
 
 import (
 	"runtime"
 	"strings"
 	"sync"
-	"sync/atomic"
-	"unsafe"
 )
 
 // Status represents the result of a non-blocking channel
@@ -76,15 +74,6 @@ func (r Result[T]) Match(ok func(T), closed, blocked func()) {
 const closeChMsg = "send on closed channel"
 const doubleCloseMsg = "close of closed channel"
 
-// Warning: hackery here! Correct as of 1.18.3
-type hchan struct {
-	_      uint
-	_      uint
-	_      unsafe.Pointer
-	_      uint16
-	closed uint32
-}
-
 // TryRecv attempts a non-blocking receive from a channel.
 func TryRecv[T any](ch <-chan T) Result[T] {
 	select {
@@ -114,18 +103,7 @@ func TryRecv[T any](ch <-chan T) Result[T] {
 // full (if it is buffered) or nobody is listening on the
 // other end (if it is unbuffered).
 func TrySend[T any](ch chan<- T, x T) (stat Status) {
-	defer func() {
-		r := recover()
-		if r == nil {
-			return
-		}
-		err, ok := r.(runtime.Error)
-		if ok && strings.Contains(err.Error(), closeChMsg) {
-			stat = Closed
-		} else {
-			panic(r)
-		}
-	}()
+	defer sendClosed(&stat)
 
 	select {
 	case ch <- x:
@@ -137,6 +115,21 @@ func TrySend[T any](ch chan<- T, x T) (stat Status) {
 	return
 }
 
+// sendClosed sets *stat to Closed if the panic being recovered
+// was caused by a send on a closed channel. It must be deferred.
+func sendClosed(stat *Status) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	err, ok := r.(runtime.Error)
+	if ok && strings.Contains(err.Error(), closeChMsg) {
+		*stat = Closed
+	} else {
+		panic(r)
+	}
+}
+
 // TryClose ensures a channel is closed. It returns true
 // if the channel was previously open, or false if the
 // channel was already closed at the time of the call.
@@ -165,10 +158,16 @@ func TryClose[T any](ch chan<- T) (ok bool) {
 // You cannot assume that the channel is not closed if this
 // function returns false. The channel may still contain
 // data to be read, use `len()` to determine that.
+//
+// IsClosed reads the runtime's internal channel struct, so it only
+// works on versions of Go whose channel layout is known to chops, in
+// which case IsClosedSupported is true. When the layout is unknown,
+// IsClosed returns false even if the channel is closed, so callers
+// that rely on it should check IsClosedSupported. Use ClosableChan
+// instead if you need to know whether a channel is closed on every
+// version of Go.
 func IsClosed[T any](ch chan T) bool {
-	c := *(**hchan)(unsafe.Pointer(&ch))
-	// See the start of runtime.chanrecv for more details
-	return atomic.LoadUint32(&c.closed) != 0
+	return isClosed(ch)
 }
 
 // RecvOr, SendOr are pointless with generics
@@ -9,6 +9,10 @@ import (
 )
 
 func TestIsClosed(t *testing.T) {
+	if !IsClosedSupported {
+		t.Skip("the channel layout of this version of Go is not known")
+	}
+
 	tests := []struct {
 		name      string
 		chFactory func() chan struct{}
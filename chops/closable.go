@@ -0,0 +1,57 @@
+package chops
+
+import "sync"
+
+// ClosableChan is a channel that records whether it has been closed,
+// so its IsClosed works on every version of Go, unlike the IsClosed
+// function. The channel must only be closed with Close.
+type ClosableChan[T any] struct {
+	ch     chan T
+	closed chan struct{}
+	mu     sync.Mutex // serializes Close
+}
+
+// NewClosableChan makes a ClosableChan with the given buffer size.
+func NewClosableChan[T any](size int) *ClosableChan[T] {
+	return &ClosableChan[T]{
+		ch:     make(chan T, size),
+		closed: make(chan struct{}),
+	}
+}
+
+// Send returns the channel to send on. Do not close it directly.
+func (c *ClosableChan[T]) Send() chan<- T {
+	return c.ch
+}
+
+// Recv returns the channel to receive from.
+func (c *ClosableChan[T]) Recv() <-chan T {
+	return c.ch
+}
+
+// Close closes the channel. Like TryClose, it returns true
+// if the channel was previously open, or false if it was
+// already closed.
+func (c *ClosableChan[T]) Close() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.IsClosed() {
+		return false
+	}
+	close(c.closed)
+	close(c.ch)
+	return true
+}
+
+// IsClosed returns true if Close has been called. Unlike the IsClosed
+// function, a false result means that the channel was open at the
+// time of the call.
+func (c *ClosableChan[T]) IsClosed() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return false
+	}
+}
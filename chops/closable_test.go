@@ -0,0 +1,24 @@
+package chops
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClosableChan(t *testing.T) {
+	c := NewClosableChan[string](1)
+	assert.False(t, c.IsClosed())
+
+	assert.Equal(t, Ok, TrySend(c.Send(), "hello"))
+	assert.True(t, c.Close())
+	assert.True(t, c.IsClosed())
+	assert.False(t, c.Close())
+
+	assert.Equal(t, Closed, TrySend(c.Send(), "world"))
+	got, stat := TryRecv(c.Recv()).Get()
+	assert.Equal(t, "hello", got)
+	assert.Equal(t, Ok, stat)
+	_, stat = TryRecv(c.Recv()).Get()
+	assert.Equal(t, Closed, stat)
+}
@@ -0,0 +1,271 @@
+package chops
+
+import (
+	"context"
+	"sync"
+)
+
+// The combinators below connect channels together. They all work the
+// same way as batcher.BatchContext: they block until every input
+// channel is closed or ctx is canceled, then close their output
+// channels and return. The returned error is the context error if
+// ctx was canceled first, or nil otherwise. Run them in their own
+// goroutines.
+//
+// Once ctx is canceled, items that were received but not sent yet
+// are discarded, and items still in the input channels are left there.
+
+// recv receives from in, unless ctx is canceled first. ok is false if
+// in is closed or ctx is canceled, and the caller can tell which from
+// ctx.Err().
+func recv[T any](ctx context.Context, in <-chan T) (x T, ok bool) {
+	select {
+	case x, ok = <-in:
+		return
+	case <-ctx.Done():
+		return x, false
+	}
+}
+
+// send sends x on out, unless ctx is canceled first.
+func send[T any](ctx context.Context, out chan<- T, x T) bool {
+	select {
+	case out <- x:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Merge sends every item received from any of ins on out. Items from
+// the same input channel are sent in order, but items from different
+// input channels may be interleaved in any way.
+func Merge[T any](ctx context.Context, out chan<- T, ins ...<-chan T) error {
+	defer close(out)
+
+	var wg sync.WaitGroup
+	wg.Add(len(ins))
+	for _, in := range ins {
+		go func(in <-chan T) {
+			defer wg.Done()
+			for {
+				x, ok := recv(ctx, in)
+				if !ok || !send(ctx, out, x) {
+					return
+				}
+			}
+		}(in)
+	}
+	wg.Wait()
+
+	return ctx.Err()
+}
+
+// TeePolicy decides what Tee does when one of its output channels
+// is not ready to receive an item.
+type TeePolicy int
+
+const (
+	// Tee waits until every output channel has received the item,
+	// so the slowest consumer limits the rate of every consumer.
+	TeeBlock TeePolicy = iota
+	// Tee doesn't send the item on output channels that can't
+	// receive it right away. Those consumers miss the item.
+	TeeDrop
+)
+
+// Tee sends every item received from in on each of outs,
+// according to policy. With TeeBlock, the item is sent on the output
+// channels in any order, so that a slow consumer doesn't delay the
+// others more than necessary.
+func Tee[T any](
+	ctx context.Context, in <-chan T, outs []chan<- T, policy TeePolicy,
+) error {
+	defer func() {
+		for _, out := range outs {
+			close(out)
+		}
+	}()
+
+	// the output channels that haven't received the current item
+	pending := make([]chan<- T, 0, len(outs))
+
+	for {
+		x, ok := recv(ctx, in)
+		if !ok {
+			return ctx.Err()
+		}
+
+		switch policy {
+		case TeeDrop:
+			for _, out := range outs {
+				select {
+				case out <- x:
+				default:
+				}
+			}
+
+		case TeeBlock:
+			pending = append(pending[:0], outs...)
+			for len(pending) > 0 {
+				// sends that can proceed right away go first
+				rest := pending[:0]
+				for _, out := range pending {
+					select {
+					case out <- x:
+					default:
+						rest = append(rest, out)
+					}
+				}
+				pending = rest
+				if len(pending) == 0 {
+					break
+				}
+				if !send(ctx, pending[0], x) {
+					return ctx.Err()
+				}
+				pending = pending[1:]
+			}
+
+		default:
+			panic("invalid TeePolicy")
+		}
+	}
+}
+
+// FanOut sends each item received from in on one of outs,
+// taking turns in round-robin order.
+func FanOut[T any](ctx context.Context, in <-chan T, outs []chan<- T) error {
+	i := 0
+	return fanOut(ctx, in, outs, func(T) int {
+		n := i
+		i = (i + 1) % len(outs)
+		return n
+	})
+}
+
+// FanOutKey sends each item received from in on one of outs, chosen
+// by the hash of the item's key. Items with the same key always go to
+// the same output channel, in order.
+func FanOutKey[T any](
+	ctx context.Context, in <-chan T, outs []chan<- T, hash func(T) uint64,
+) error {
+	n := uint64(len(outs))
+	return fanOut(ctx, in, outs, func(x T) int {
+		return int(hash(x) % n)
+	})
+}
+
+func fanOut[T any](
+	ctx context.Context, in <-chan T, outs []chan<- T, choose func(T) int,
+) error {
+	defer func() {
+		for _, out := range outs {
+			close(out)
+		}
+	}()
+
+	if len(outs) == 0 {
+		panic("no output channels")
+	}
+
+	for {
+		x, ok := recv(ctx, in)
+		if !ok || !send(ctx, outs[choose(x)], x) {
+			return ctx.Err()
+		}
+	}
+}
+
+// OrDone sends every item received from in on out. It is useful to
+// stop receiving from a channel that doesn't respect ctx.
+func OrDone[T any](ctx context.Context, in <-chan T, out chan<- T) error {
+	return Map(ctx, in, out, func(x T) T { return x })
+}
+
+// Take sends the first n items received from in on out, then returns.
+// The remaining items are not received from in.
+func Take[T any](ctx context.Context, in <-chan T, out chan<- T, n int) error {
+	defer close(out)
+
+	for ; n > 0; n-- {
+		x, ok := recv(ctx, in)
+		if !ok || !send(ctx, out, x) {
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Skip discards the first n items received from in, then sends
+// the rest on out.
+func Skip[T any](ctx context.Context, in <-chan T, out chan<- T, n int) error {
+	return Filter(ctx, in, out, func(T) bool {
+		if n > 0 {
+			n--
+			return false
+		}
+		return true
+	})
+}
+
+// Map sends f(x) on out for every item x received from in.
+func Map[T, U any](
+	ctx context.Context, in <-chan T, out chan<- U, f func(T) U,
+) error {
+	defer close(out)
+
+	for {
+		x, ok := recv(ctx, in)
+		if !ok || !send(ctx, out, f(x)) {
+			return ctx.Err()
+		}
+	}
+}
+
+// Filter sends the items received from in for which keep
+// returns true on out.
+func Filter[T any](
+	ctx context.Context, in <-chan T, out chan<- T, keep func(T) bool,
+) error {
+	defer close(out)
+
+	for {
+		x, ok := recv(ctx, in)
+		if !ok {
+			return ctx.Err()
+		}
+		if keep(x) && !send(ctx, out, x) {
+			return ctx.Err()
+		}
+	}
+}
+
+// Pair is an item from each of the input channels of Zip.
+type Pair[A, B any] struct {
+	First  A
+	Second B
+}
+
+// Zip receives an item from each of a and b, then sends them together
+// on out, until either a or b is closed. If one of them is closed
+// first, the item already received from the other is discarded.
+func Zip[A, B any](
+	ctx context.Context, a <-chan A, b <-chan B, out chan<- Pair[A, B],
+) error {
+	defer close(out)
+
+	for {
+		x, ok := recv(ctx, a)
+		if !ok {
+			return ctx.Err()
+		}
+		y, ok := recv(ctx, b)
+		if !ok {
+			return ctx.Err()
+		}
+		if !send(ctx, out, Pair[A, B]{x, y}) {
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package chops
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+// source returns a closed channel containing xs.
+func source[T any](xs ...T) <-chan T {
+	ch := make(chan T, len(xs))
+	for _, x := range xs {
+		ch <- x
+	}
+	close(ch)
+	return ch
+}
+
+// collect receives everything from ch until it is closed.
+func collect[T any](ch <-chan T) []T {
+	var xs []T
+	for x := range ch {
+		xs = append(xs, x)
+	}
+	return xs
+}
+
+func TestMerge(t *testing.T) {
+	out := make(chan int)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- Merge(context.Background(), out,
+			source(1, 2, 3), source(4, 5), source[int]())
+	}()
+
+	assert.ElementsMatch(t, []int{1, 2, 3, 4, 5}, collect(out))
+	assert.NoError(t, <-errc)
+	goleak.VerifyNone(t)
+}
+
+func TestTee(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy TeePolicy
+		outCap int
+		want   []int
+	}{
+		{"block", TeeBlock, 0, []int{1, 2, 3}},
+		{"drop", TeeDrop, 1, []int{1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fast := make(chan int, 3)
+			slow := make(chan int, tt.outCap)
+			errc := make(chan error, 1)
+			go func() {
+				errc <- Tee(context.Background(), source(1, 2, 3),
+					[]chan<- int{fast, slow}, tt.policy)
+			}()
+
+			if tt.policy == TeeDrop {
+				// nobody receives from slow until Tee is done
+				assert.NoError(t, <-errc)
+				assert.Equal(t, tt.want, collect(slow))
+			} else {
+				assert.Equal(t, tt.want, collect(slow))
+				assert.NoError(t, <-errc)
+			}
+			assert.Equal(t, []int{1, 2, 3}, collect(fast))
+			goleak.VerifyNone(t)
+		})
+	}
+}
+
+func TestFanOut(t *testing.T) {
+	a, b := make(chan int, 4), make(chan int, 4)
+	err := FanOut(context.Background(), source(1, 2, 3, 4, 5),
+		[]chan<- int{a, b})
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 3, 5}, collect(a))
+	assert.Equal(t, []int{2, 4}, collect(b))
+
+	a, b = make(chan int, 4), make(chan int, 4)
+	err = FanOutKey(context.Background(), source(1, 2, 3, 4, 5),
+		[]chan<- int{a, b}, func(x int) uint64 { return uint64(x / 3) })
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, collect(a))
+	assert.Equal(t, []int{3, 4, 5}, collect(b))
+}
+
+func TestOrDone(t *testing.T) {
+	in := make(chan int)
+	out := make(chan int)
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		errc <- OrDone(ctx, in, out)
+	}()
+
+	in <- 1
+	assert.Equal(t, 1, <-out)
+	cancel()
+	assert.ErrorIs(t, <-errc, context.Canceled)
+	_, ok := <-out
+	assert.False(t, ok)
+	goleak.VerifyNone(t)
+}
+
+func TestTakeSkip(t *testing.T) {
+	in := source(1, 2, 3, 4, 5)
+	out := make(chan int, 5)
+	assert.NoError(t, Take(context.Background(), in, out, 2))
+	assert.Equal(t, []int{1, 2}, collect(out))
+
+	out = make(chan int, 5)
+	assert.NoError(t, Skip(context.Background(), in, out, 2))
+	assert.Equal(t, []int{5}, collect(out))
+}
+
+func TestMapFilter(t *testing.T) {
+	strs := make(chan string, 5)
+	assert.NoError(t, Map(context.Background(), source(1, 2, 3), strs,
+		func(x int) string { return string(rune('a' + x)) }))
+	assert.Equal(t, []string{"b", "c", "d"}, collect(strs))
+
+	evens := make(chan int, 5)
+	assert.NoError(t, Filter(context.Background(), source(1, 2, 3, 4), evens,
+		func(x int) bool { return x%2 == 0 }))
+	assert.Equal(t, []int{2, 4}, collect(evens))
+}
+
+func TestZip(t *testing.T) {
+	out := make(chan Pair[int, string], 3)
+	err := Zip(context.Background(), source(1, 2, 3), source("a", "b"), out)
+	assert.NoError(t, err)
+	assert.Equal(t, []Pair[int, string]{{1, "a"}, {2, "b"}}, collect(out))
+}
@@ -0,0 +1,33 @@
+//go:build go1.18 && !go1.28
+
+package chops
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// IsClosedSupported is true if IsClosed works on this version of Go.
+const IsClosedSupported = true
+
+// hchan is the start of runtime.hchan. These fields have not changed
+// from Go 1.18 through Go 1.27, although fields were added after
+// closed. TestHchanLayout checks this against the runtime source.
+// Before allowing a new version of Go in the build constraint above,
+// run the tests with it.
+type hchan struct {
+	qcount   uint
+	dataqsiz uint
+	buf      unsafe.Pointer
+	elemsize uint16
+	closed   uint32
+}
+
+func chanOf[T any](ch chan T) *hchan {
+	return *(**hchan)(unsafe.Pointer(&ch))
+}
+
+func isClosed[T any](ch chan T) bool {
+	// See the start of runtime.chanrecv for more details
+	return atomic.LoadUint32(&chanOf(ch).closed) != 0
+}
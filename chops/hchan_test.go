@@ -0,0 +1,71 @@
+//go:build go1.18 && !go1.28
+
+package chops
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestHchanLayout checks that hchan matches the start of
+// runtime.hchan in the source of the Go version running the test.
+func TestHchanLayout(t *testing.T) {
+	path := filepath.Join(runtime.GOROOT(), "src", "runtime", "chan.go")
+	f, err := parser.ParseFile(token.NewFileSet(), path, nil, 0)
+	if err != nil {
+		t.Skipf("runtime source not available: %v", err)
+	}
+
+	var fields []*ast.Field
+	ast.Inspect(f, func(n ast.Node) bool {
+		spec, ok := n.(*ast.TypeSpec)
+		if ok && spec.Name.Name == "hchan" {
+			fields = spec.Type.(*ast.StructType).Fields.List
+			return false
+		}
+		return true
+	})
+	require.NotNil(t, fields, "runtime.hchan not found in %s", path)
+
+	ours := reflect.TypeOf(hchan{})
+	require.GreaterOrEqual(t, len(fields), ours.NumField())
+	for i := 0; i < ours.NumField(); i++ {
+		want := ours.Field(i)
+		got := fields[i]
+		require.Len(t, got.Names, 1)
+		assert.Equal(t, want.Name, got.Names[0].Name)
+
+		var typ string
+		switch x := got.Type.(type) {
+		case *ast.Ident:
+			typ = x.Name
+		case *ast.SelectorExpr:
+			typ = x.X.(*ast.Ident).Name + "." + x.Sel.Name
+		}
+		assert.Equal(t, want.Type.String(), typ, "type of %s", want.Name)
+	}
+}
+
+func TestHchan(t *testing.T) {
+	ch := make(chan int64, 3)
+	ch <- 1
+	ch <- 2
+
+	c := chanOf(ch)
+	assert.Equal(t, uint(2), c.qcount)
+	assert.Equal(t, uint(3), c.dataqsiz)
+	assert.Equal(t, uint16(unsafe.Sizeof(int64(0))), c.elemsize)
+	assert.Zero(t, c.closed)
+
+	close(ch)
+	assert.NotZero(t, c.closed)
+}
@@ -0,0 +1,13 @@
+//go:build go1.28
+
+package chops
+
+// IsClosedSupported is true if IsClosed works on this version of Go.
+const IsClosedSupported = false
+
+// The channel layout of this version of Go is not known, and reading
+// the wrong field could return anything, so IsClosed gives up and
+// always returns false. IsClosedSupported tells callers about this.
+func isClosed[T any](chan T) bool {
+	return false
+}
@@ -0,0 +1,132 @@
+package chops
+
+import (
+	"context"
+	"reflect"
+	"time"
+)
+
+// RecvTimeout receives from a channel, waiting at most d.
+// The Result is like that of TryRecv: if nothing could be received
+// before d elapsed, its Status is Blocked.
+func RecvTimeout[T any](ch <-chan T, d time.Duration) Result[T] {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case x, ok := <-ch:
+		return recvResult(x, ok)
+	case <-t.C:
+		return Result[T]{status: Blocked}
+	}
+}
+
+// RecvContext receives from a channel, unless ctx is canceled first.
+// The Result is like that of TryRecv: if ctx was canceled before
+// anything could be received, its Status is Blocked.
+func RecvContext[T any](ctx context.Context, ch <-chan T) Result[T] {
+	select {
+	case x, ok := <-ch:
+		return recvResult(x, ok)
+	case <-ctx.Done():
+		return Result[T]{status: Blocked}
+	}
+}
+
+func recvResult[T any](x T, ok bool) Result[T] {
+	if !ok {
+		return Result[T]{status: Closed}
+	}
+	return Result[T]{value: x, status: Ok}
+}
+
+// SendTimeout sends to a channel, waiting at most d.
+// The Status is like that of TrySend: if x could not be sent
+// before d elapsed, it is Blocked.
+func SendTimeout[T any](ch chan<- T, x T, d time.Duration) (stat Status) {
+	defer sendClosed(&stat)
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case ch <- x:
+		return Ok
+	case <-t.C:
+		return Blocked
+	}
+}
+
+// SendContext sends to a channel, unless ctx is canceled first.
+// The Status is like that of TrySend: if ctx was canceled before
+// x could be sent, it is Blocked.
+func SendContext[T any](ctx context.Context, ch chan<- T, x T) (stat Status) {
+	defer sendClosed(&stat)
+
+	select {
+	case ch <- x:
+		return Ok
+	case <-ctx.Done():
+		return Blocked
+	}
+}
+
+// SelectRecv receives from whichever of chans is ready first, like a
+// select statement with a receive case for each channel. It returns
+// the index of that channel, the value received, and whether the
+// value was sent rather than received because the channel is closed.
+// Like select, nil channels are never chosen, and if chans is empty,
+// SelectRecv blocks forever.
+//
+// For up to 4 channels, SelectRecv uses an ordinary select,
+// otherwise it uses reflect.Select, which is a lot slower.
+func SelectRecv[T any](chans []<-chan T) (i int, x T, ok bool) {
+	switch len(chans) {
+	case 1:
+		x, ok = <-chans[0]
+		return 0, x, ok
+	case 2:
+		select {
+		case x, ok = <-chans[0]:
+			return 0, x, ok
+		case x, ok = <-chans[1]:
+			return 1, x, ok
+		}
+	case 3:
+		select {
+		case x, ok = <-chans[0]:
+			return 0, x, ok
+		case x, ok = <-chans[1]:
+			return 1, x, ok
+		case x, ok = <-chans[2]:
+			return 2, x, ok
+		}
+	case 4:
+		select {
+		case x, ok = <-chans[0]:
+			return 0, x, ok
+		case x, ok = <-chans[1]:
+			return 1, x, ok
+		case x, ok = <-chans[2]:
+			return 2, x, ok
+		case x, ok = <-chans[3]:
+			return 3, x, ok
+		}
+	}
+
+	cases := make([]reflect.SelectCase, len(chans))
+	for i, ch := range chans {
+		cases[i] = reflect.SelectCase{
+			Dir:  reflect.SelectRecv,
+			Chan: reflect.ValueOf(ch),
+		}
+	}
+
+	i, v, ok := reflect.Select(cases)
+	if ok {
+		// not v.Interface().(T), which panics if
+		// T is an interface type and v is nil
+		reflect.ValueOf(&x).Elem().Set(v)
+	}
+	return i, x, ok
+}
@@ -0,0 +1,105 @@
+package chops
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecvTimeout(t *testing.T) {
+	ch := make(chan int, 1)
+	_, stat := RecvTimeout(ch, time.Millisecond).Get()
+	assert.Equal(t, Blocked, stat)
+
+	ch <- 1
+	x, stat := RecvTimeout(ch, time.Millisecond).Get()
+	assert.Equal(t, 1, x)
+	assert.Equal(t, Ok, stat)
+
+	close(ch)
+	_, stat = RecvTimeout(ch, time.Millisecond).Get()
+	assert.Equal(t, Closed, stat)
+}
+
+func TestRecvContext(t *testing.T) {
+	ch := make(chan int, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	ch <- 1
+	x, stat := RecvContext(ctx, ch).Get()
+	assert.Equal(t, 1, x)
+	assert.Equal(t, Ok, stat)
+
+	cancel()
+	_, stat = RecvContext(ctx, ch).Get()
+	assert.Equal(t, Blocked, stat)
+
+	close(ch)
+	_, stat = RecvContext(context.Background(), ch).Get()
+	assert.Equal(t, Closed, stat)
+}
+
+func TestSendTimeout(t *testing.T) {
+	ch := make(chan int, 1)
+	assert.Equal(t, Ok, SendTimeout(ch, 1, time.Millisecond))
+	assert.Equal(t, Blocked, SendTimeout(ch, 2, time.Millisecond))
+
+	close(ch)
+	assert.Equal(t, Closed, SendTimeout(ch, 3, time.Millisecond))
+}
+
+func TestSendContext(t *testing.T) {
+	ch := make(chan int, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	assert.Equal(t, Ok, SendContext(ctx, ch, 1))
+	cancel()
+	assert.Equal(t, Blocked, SendContext(ctx, ch, 2))
+
+	close(ch)
+	assert.Equal(t, Closed, SendContext(context.Background(), ch, 3))
+}
+
+func TestSelectRecv(t *testing.T) {
+	// both the fast path and reflect.Select
+	for _, n := range []int{1, 2, 3, 4, 5, 8} {
+		chans := make([]chan error, n)
+		recv := make([]<-chan error, n)
+		for i := range chans {
+			chans[i] = make(chan error, 1)
+			recv[i] = chans[i]
+		}
+
+		last := n - 1
+		chans[last] <- context.Canceled
+		i, x, ok := SelectRecv(recv)
+		assert.Equal(t, last, i)
+		assert.Equal(t, context.Canceled, x)
+		assert.True(t, ok)
+
+		// a nil interface value
+		chans[0] <- nil
+		i, x, ok = SelectRecv(recv)
+		assert.Equal(t, 0, i)
+		assert.Nil(t, x)
+		assert.True(t, ok)
+
+		close(chans[last])
+		i, _, ok = SelectRecv(recv)
+		assert.Equal(t, last, i)
+		assert.False(t, ok)
+	}
+}
+
+func TestSelectRecv_Nil(t *testing.T) {
+	ch := make(chan int, 1)
+	ch <- 1
+	chans := []<-chan int{nil, nil, nil, nil, nil, ch}
+
+	i, x, ok := SelectRecv(chans)
+	assert.Equal(t, 5, i)
+	assert.Equal(t, 1, x)
+	assert.True(t, ok)
+}
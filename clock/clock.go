@@ -0,0 +1,214 @@
+// Package clock abstracts the parts of package time that are used
+// for timeouts, so that code which depends on the passage of time
+// can be tested deterministically. Use Real in production code,
+// and Fake in tests.
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock tells the time and creates timers.
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is a one-shot timer, like *time.Timer.
+// Stop and Reset behave like their counterparts on *time.Timer,
+// so if Stop returns false, the expiry time has already been sent
+// on the channel returned by C (or is about to be).
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// Real is the Clock provided by package time.
+type Real struct{}
+
+var _ Clock = Real{}
+
+func (Real) Now() time.Time {
+	return time.Now()
+}
+
+func (Real) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+type realTimer struct {
+	*time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+// Fake is a Clock that only moves forward when Advance is called.
+// Timers created by a Fake expire once Advance moves the time past
+// their expiry time. Fake is safe for concurrent use.
+type Fake struct {
+	lock sync.Mutex
+	cond *sync.Cond // signaled when a timer starts
+	now  time.Time
+	// the running timers, in no particular order
+	timers []*fakeTimer
+}
+
+var _ Clock = (*Fake)(nil)
+
+// NewFake creates a Fake set to the time now.
+func NewFake(now time.Time) *Fake {
+	f := &Fake{now: now}
+	f.cond = sync.NewCond(&f.lock)
+	return f
+}
+
+type fakeTimer struct {
+	f        *Fake
+	c        chan time.Time
+	deadline time.Time
+	// protected by f.lock
+	running bool
+}
+
+func (f *Fake) Now() time.Time {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.now
+}
+
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	t := &fakeTimer{
+		f: f,
+		c: make(chan time.Time, 1),
+	}
+
+	f.lock.Lock()
+	t.start(d)
+	f.lock.Unlock()
+
+	return t
+}
+
+// Advance moves the time forward by d, and expires timers
+// in order of their expiry times.
+func (f *Fake) Advance(d time.Duration) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.now = f.now.Add(d)
+
+	var expired []*fakeTimer
+	running := f.timers[:0]
+	for _, t := range f.timers {
+		if t.deadline.After(f.now) {
+			running = append(running, t)
+		} else {
+			expired = append(expired, t)
+		}
+	}
+	// don't keep the expired timers alive
+	for i := len(running); i < len(f.timers); i++ {
+		f.timers[i] = nil
+	}
+	f.timers = running
+
+	sort.SliceStable(expired, func(i, j int) bool {
+		return expired[i].deadline.Before(expired[j].deadline)
+	})
+
+	for _, t := range expired {
+		t.fire()
+	}
+}
+
+// WaitTimers blocks until at least n timers created by f are running,
+// i.e. they have been created or reset, but have not expired or been
+// stopped. Call this before Advance to make sure that the code under
+// test has started its timers.
+func (f *Fake) WaitTimers(n int) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for len(f.timers) < n {
+		f.cond.Wait()
+	}
+}
+
+// remove removes a running timer from f.timers.
+// f.lock must be held.
+func (f *Fake) remove(t *fakeTimer) {
+	for i, u := range f.timers {
+		if u == t {
+			last := len(f.timers) - 1
+			f.timers[i] = f.timers[last]
+			f.timers[last] = nil
+			f.timers = f.timers[:last]
+			return
+		}
+	}
+}
+
+// start must be called with f.lock held.
+func (t *fakeTimer) start(d time.Duration) {
+	if d < 0 {
+		// like a real timer, it expires right away
+		d = 0
+	}
+	t.deadline = t.f.now.Add(d)
+
+	if d == 0 {
+		if t.running {
+			t.f.remove(t)
+		}
+		t.fire()
+		return
+	}
+
+	if !t.running {
+		t.running = true
+		t.f.timers = append(t.f.timers, t)
+	}
+	t.f.cond.Broadcast()
+}
+
+// fire must be called with f.lock held, after t has been
+// removed from f.timers.
+func (t *fakeTimer) fire() {
+	t.running = false
+	// like a real timer, send the expiry time, and drop it
+	// if the last one was never received
+	select {
+	case t.c <- t.deadline:
+	default:
+	}
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.f.lock.Lock()
+	defer t.f.lock.Unlock()
+
+	wasRunning := t.running
+	if wasRunning {
+		t.f.remove(t)
+		t.running = false
+	}
+	return wasRunning
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.f.lock.Lock()
+	defer t.f.lock.Unlock()
+
+	wasRunning := t.running
+	t.start(d)
+	return wasRunning
+}
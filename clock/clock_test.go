@@ -0,0 +1,91 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.lepak.sg/playground/chops"
+)
+
+func TestFake(t *testing.T) {
+	start := time.Unix(1000, 0)
+	f := NewFake(start)
+	assert.Equal(t, start, f.Now())
+
+	t1 := f.NewTimer(time.Second)
+	t2 := f.NewTimer(2 * time.Second)
+	f.WaitTimers(2)
+
+	f.Advance(time.Second - 1)
+	_, stat := chops.TryRecv(t1.C()).Get()
+	assert.Equal(t, chops.Blocked, stat)
+
+	f.Advance(1)
+	fired, stat := chops.TryRecv(t1.C()).Get()
+	assert.Equal(t, chops.Ok, stat)
+	assert.Equal(t, start.Add(time.Second), fired)
+	assert.False(t, t1.Stop(), "t1 already expired")
+
+	assert.True(t, t2.Stop(), "t2 still running")
+	f.Advance(time.Hour)
+	_, stat = chops.TryRecv(t2.C()).Get()
+	assert.Equal(t, chops.Blocked, stat, "t2 fired after Stop")
+
+	assert.False(t, t2.Reset(time.Second))
+	f.Advance(time.Second)
+	fired, stat = chops.TryRecv(t2.C()).Get()
+	assert.Equal(t, chops.Ok, stat)
+	assert.Equal(t, f.Now(), fired)
+}
+
+func TestFake_SendsDeadline(t *testing.T) {
+	start := time.Unix(1000, 0)
+	f := NewFake(start)
+
+	t1 := f.NewTimer(time.Second)
+	f.Advance(time.Hour)
+	// the expiry time, not the time when Advance was called
+	assert.Equal(t, start.Add(time.Second), <-t1.C())
+
+	t1.Reset(-time.Second)
+	assert.Equal(t, f.Now(), <-t1.C())
+}
+
+func TestFake_ForgetsTimers(t *testing.T) {
+	f := NewFake(time.Unix(0, 0))
+
+	for i := 0; i < 1000; i++ {
+		t1 := f.NewTimer(time.Second)
+		t2 := f.NewTimer(time.Second)
+		t2.Reset(2 * time.Second)
+		f.Advance(time.Second)
+		<-t1.C()
+		t2.Stop()
+	}
+
+	// neither expired nor stopped timers are kept
+	assert.Empty(t, f.timers)
+
+	t1 := f.NewTimer(time.Second)
+	t2 := f.NewTimer(time.Second)
+	t1.Reset(2 * time.Second)
+	assert.Len(t, f.timers, 2)
+	f.Advance(time.Second)
+	<-t2.C()
+	assert.Len(t, f.timers, 1)
+	f.WaitTimers(1)
+}
+
+func TestFake_WaitTimers(t *testing.T) {
+	f := NewFake(time.Unix(0, 0))
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		f.NewTimer(time.Second)
+	}()
+
+	f.WaitTimers(1)
+	f.Advance(time.Second)
+	f.WaitTimers(0)
+}
@@ -1,14 +1,23 @@
 // Package counter counts occurrences of elements in slices
 // and also returns their k most- or least-frequent elements.
-// It also provides utility functions for working with counters.
+// It also provides utility functions for working with counters,
+// such as multiset operations and statistics, and estimators
+// for streams that are too large to count exactly.
 package counter
 
 import "golang.org/x/exp/constraints"
 
+// Number is the type of counts. Use int64 for counts that may be
+// very large, or float64 for weighted counts.
+type Number interface {
+	constraints.Integer | constraints.Float
+}
+
 // Counter counts occurrences of each element of the slice
-// and returns a map of elements to their counts.
-func Counter[S ~[]E, E comparable](slice S) map[E]int {
-	c := make(map[E]int)
+// and returns a map of elements to their counts. The type of
+// the counts must be given, e.g. Counter[int](slice).
+func Counter[N Number, S ~[]E, E comparable](slice S) map[E]N {
+	c := make(map[E]N)
 
 	for _, v := range slice {
 		c[v]++
@@ -17,9 +26,23 @@ func Counter[S ~[]E, E comparable](slice S) map[E]int {
 	return c
 }
 
+// WeightedCounter is like Counter, but each element of the slice
+// counts as weight of that element, instead of as 1.
+func WeightedCounter[S ~[]E, E comparable, N Number](
+	slice S, weight func(E) N,
+) map[E]N {
+	c := make(map[E]N)
+
+	for _, v := range slice {
+		c[v] += weight(v)
+	}
+
+	return c
+}
+
 // fold makes a copy of a, then folds b into it using the function f.
-func fold[E comparable](a, b map[E]int, f func(a, b int) int) map[E]int {
-	sum := make(map[E]int, len(a))
+func fold[E comparable, N Number](a, b map[E]N, f func(a, b N) N) map[E]N {
+	sum := make(map[E]N, len(a))
 
 	for el, cnt := range a {
 		sum[el] = cnt
@@ -33,18 +56,18 @@ func fold[E comparable](a, b map[E]int, f func(a, b int) int) map[E]int {
 }
 
 // Add adds counter a and b together and returns a copy.
-func Add[E comparable](a, b map[E]int) map[E]int {
-	return fold(a, b, func(l, r int) int { return l + r })
+func Add[E comparable, N Number](a, b map[E]N) map[E]N {
+	return fold(a, b, func(l, r N) N { return l + r })
 }
 
 // Subtract subtracts the counter b from a and returns a copy.
-func Subtract[E comparable](a, b map[E]int) map[E]int {
-	return fold(a, b, func(l, r int) int { return l - r })
+func Subtract[E comparable, N Number](a, b map[E]N) map[E]N {
+	return fold(a, b, func(l, r N) N { return l - r })
 }
 
 // Total sums up all counts in the counter.
-func Total[E comparable](ctr map[E]int) int {
-	sum := 0
+func Total[E comparable, N Number](ctr map[E]N) N {
+	var sum N
 
 	for _, cnt := range ctr {
 		sum += cnt
@@ -53,7 +76,7 @@ func Total[E comparable](ctr map[E]int) int {
 	return sum
 }
 
-func Average[E constraints.Integer | constraints.Float](ctr map[E]int) float64 {
+func Average[E Number, N Number](ctr map[E]N) float64 {
 	var sum float64
 
 	total := float64(Total(ctr))
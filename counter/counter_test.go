@@ -38,7 +38,7 @@ func TestCounter(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := Counter([]byte(tt.list)); !reflect.DeepEqual(got, tt.want) {
+			if got := Counter[int]([]byte(tt.list)); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("Counter() = %v, want %v", got, tt.want)
 			}
 		})
@@ -305,3 +305,37 @@ func TestTotal(t *testing.T) {
 		})
 	}
 }
+
+func TestWeightedCounter(t *testing.T) {
+	words := []string{"go", "gopher", "go", "chan"}
+
+	assert.Equal(t, map[string]int{"go": 4, "gopher": 6, "chan": 4},
+		WeightedCounter(words, func(s string) int { return len(s) }))
+	assert.Equal(t, map[string]float64{"go": 1, "gopher": 0.5, "chan": 0.5},
+		WeightedCounter(words, func(string) float64 { return 0.5 }))
+	assert.Equal(t, map[string]int{},
+		WeightedCounter([]string(nil), func(string) int { return 1 }))
+}
+
+func TestCountTypes(t *testing.T) {
+	big := map[byte]int64{'a': 1 << 40, 'b': 1 << 41}
+	assert.Equal(t, int64(3<<40), Total(big))
+	assert.Equal(t, map[byte]int64{'a': 2 << 40, 'b': 1 << 41},
+		Add(big, map[byte]int64{'a': 1 << 40}))
+	assert.Equal(t, []Entry[byte, int64]{{Element: 'b', Count: 1 << 41}},
+		TopK(big, 1))
+
+	weights := map[byte]float64{'a': 0.25, 'b': 1.5, 'c': 0.75}
+	assert.Equal(t, 2.5, Total(weights))
+	assert.Equal(t, map[byte]float64{'a': 0, 'b': 1.5, 'c': 0.5},
+		Subtract(weights, map[byte]float64{'a': 0.25, 'c': 0.25}))
+	assert.Equal(t, []Entry[byte, float64]{
+		{Element: 'b', Count: 1.5},
+		{Element: 'c', Count: 0.75},
+	}, TopKAlt(weights, 2))
+	assert.Equal(t, []Entry[byte, float64]{{Element: 'a', Count: 0.25}},
+		BottomK(weights, 1))
+
+	assert.InDelta(t, 2.5, Average(map[int]float64{1: 0.5, 4: 0.5}), 1e-9)
+	assert.Equal(t, map[byte]uint8{'a': 2, 'b': 1}, Counter[uint8]([]byte("aba")))
+}
@@ -0,0 +1,135 @@
+package counter
+
+// CountMin is a Count-Min Sketch, which estimates how many times each
+// element occurred in a stream, using a fixed amount of memory.
+// Estimates are never too low. With a width of w and a depth of d,
+// an estimate is too high by more than 2/w of the total count with
+// a probability of at most 1/2^d.
+type CountMin[E comparable] struct {
+	width, depth int
+	total        uint64
+	// depth rows of width counters
+	counts []uint64
+	hash   func(E) uint64
+}
+
+const countMinMagic = "CMS1"
+
+// NewCountMin makes a CountMin with the given width and depth,
+// which hashes elements with hash. hash must give the same result
+// for the same element in every process, e.g. HashString.
+// It panics if width or depth is not positive.
+func NewCountMin[E comparable](width, depth int, hash func(E) uint64) *CountMin[E] {
+	if width <= 0 || depth <= 0 {
+		panic("invalid size")
+	}
+
+	return &CountMin[E]{
+		width:  width,
+		depth:  depth,
+		counts: make([]uint64, width*depth),
+		hash:   hash,
+	}
+}
+
+// index returns the column of el in each row, using the
+// Kirsch-Mitzenmacher scheme to derive depth hashes from one.
+func (c *CountMin[E]) index(el E, row int) int {
+	h := mix64(c.hash(el))
+	h1, h2 := h&0xffffffff, h>>32
+	return row*c.width + int((h1+uint64(row)*h2)%uint64(c.width))
+}
+
+// Observe counts one occurrence of el.
+func (c *CountMin[E]) Observe(el E) {
+	c.Add(el, 1)
+}
+
+// Add counts n occurrences of el.
+func (c *CountMin[E]) Add(el E, n uint64) {
+	c.total += n
+	for row := 0; row < c.depth; row++ {
+		c.counts[c.index(el, row)] += n
+	}
+}
+
+// Count returns the estimated number of occurrences of el.
+func (c *CountMin[E]) Count(el E) uint64 {
+	var min uint64
+	for row := 0; row < c.depth; row++ {
+		n := c.counts[c.index(el, row)]
+		if row == 0 || n < min {
+			min = n
+		}
+	}
+	return min
+}
+
+// Total returns the total count of all elements.
+func (c *CountMin[E]) Total() uint64 {
+	return c.total
+}
+
+// Merge adds the counts of other into c, like Add does for exact
+// counters. It returns ErrIncompatible if c and other don't have
+// the same width and depth.
+func (c *CountMin[E]) Merge(other *CountMin[E]) error {
+	if c.width != other.width || c.depth != other.depth {
+		return ErrIncompatible
+	}
+
+	c.total += other.total
+	for i, n := range other.counts {
+		c.counts[i] += n
+	}
+	return nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (c *CountMin[E]) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 0, len(countMinMagic)+3*2+len(c.counts)*2)
+	b = append(b, countMinMagic...)
+	b = appendUvarint(b, uint64(c.width))
+	b = appendUvarint(b, uint64(c.depth))
+	b = appendUvarint(b, c.total)
+	for _, n := range c.counts {
+		b = appendUvarint(b, n)
+	}
+	return b, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler. It replaces
+// the width, depth and counts of c, but keeps its hash function, so
+// c should be made by NewCountMin with the hash function that the
+// serialized sketch used.
+func (c *CountMin[E]) UnmarshalBinary(data []byte) error {
+	r := sketchReader{data: data}
+	r.magic(countMinMagic)
+	width := r.uvarint()
+	depth := r.uvarint()
+	total := r.uvarint()
+	if r.err != nil {
+		return r.err
+	}
+	// every count takes at least a byte
+	n := uint64(len(r.data))
+	if width == 0 || depth == 0 || width > n || depth > n ||
+		width*depth > n {
+		return ErrInvalidSketch
+	}
+
+	counts := make([]uint64, width*depth)
+	for i := range counts {
+		counts[i] = r.uvarint()
+	}
+	if r.err != nil {
+		return r.err
+	}
+	if len(r.data) != 0 {
+		return ErrInvalidSketch
+	}
+
+	c.width, c.depth, c.total, c.counts =
+		int(width), int(depth), total, counts
+	return nil
+}
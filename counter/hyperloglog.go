@@ -0,0 +1,134 @@
+package counter
+
+import (
+	"math"
+	"math/bits"
+)
+
+// HyperLogLog estimates the number of distinct elements in a stream,
+// using a fixed amount of memory. With a precision of p, it uses 2^p
+// bytes, and the standard error of its estimates is about
+// 1.04/sqrt(2^p), e.g. 1.6% for a precision of 12.
+type HyperLogLog[E comparable] struct {
+	p    uint8
+	regs []uint8
+	hash func(E) uint64
+}
+
+const hyperLogLogMagic = "HLL1"
+
+// NewHyperLogLog makes a HyperLogLog with the given precision, which
+// hashes elements with hash. hash must give the same result for the
+// same element in every process, e.g. HashString. It panics if
+// precision is not between 4 and 18.
+func NewHyperLogLog[E comparable](precision int, hash func(E) uint64) *HyperLogLog[E] {
+	if precision < 4 || precision > 18 {
+		panic("invalid precision")
+	}
+
+	return &HyperLogLog[E]{
+		p:    uint8(precision),
+		regs: make([]uint8, 1<<precision),
+		hash: hash,
+	}
+}
+
+// Observe records an occurrence of el.
+func (h *HyperLogLog[E]) Observe(el E) {
+	x := mix64(h.hash(el))
+	// the first p bits choose the register,
+	// the rest are used for the rank
+	i := x >> (64 - h.p)
+	rank := uint8(bits.LeadingZeros64(x<<h.p|1<<(h.p-1))) + 1
+	if rank > h.regs[i] {
+		h.regs[i] = rank
+	}
+}
+
+// Count returns the estimated number of distinct elements observed.
+func (h *HyperLogLog[E]) Count() uint64 {
+	m := float64(len(h.regs))
+
+	var sum float64
+	zeros := 0
+	for _, r := range h.regs {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	var alpha float64
+	switch len(h.regs) {
+	case 16:
+		alpha = 0.673
+	case 32:
+		alpha = 0.697
+	case 64:
+		alpha = 0.709
+	default:
+		alpha = 0.7213 / (1 + 1.079/m)
+	}
+
+	est := alpha * m * m / sum
+	if est <= 2.5*m && zeros > 0 {
+		// linear counting is more accurate for small counts
+		est = m * math.Log(m/float64(zeros))
+	}
+	return uint64(est + 0.5)
+}
+
+// Merge combines other into h, so h estimates the number of distinct
+// elements observed by either. It returns ErrIncompatible if h and
+// other don't have the same precision.
+func (h *HyperLogLog[E]) Merge(other *HyperLogLog[E]) error {
+	if h.p != other.p {
+		return ErrIncompatible
+	}
+
+	for i, r := range other.regs {
+		if r > h.regs[i] {
+			h.regs[i] = r
+		}
+	}
+	return nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (h *HyperLogLog[E]) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 0, len(hyperLogLogMagic)+1+len(h.regs))
+	b = append(b, hyperLogLogMagic...)
+	b = append(b, h.p)
+	b = append(b, h.regs...)
+	return b, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler. It replaces
+// the precision and registers of h, but keeps its hash function, so
+// h should be made by NewHyperLogLog with the hash function that the
+// serialized sketch used.
+func (h *HyperLogLog[E]) UnmarshalBinary(data []byte) error {
+	r := sketchReader{data: data}
+	r.magic(hyperLogLogMagic)
+	if r.err != nil {
+		return r.err
+	}
+	if len(r.data) < 1 {
+		return ErrInvalidSketch
+	}
+
+	p := r.data[0]
+	regs := r.data[1:]
+	if p < 4 || p > 18 || len(regs) != 1<<p {
+		return ErrInvalidSketch
+	}
+	for _, reg := range regs {
+		if reg > 64-p+1 {
+			return ErrInvalidSketch
+		}
+	}
+
+	h.p = p
+	h.regs = append([]uint8(nil), regs...)
+	return nil
+}
@@ -0,0 +1,122 @@
+package counter
+
+// The functions in this file treat counters as multisets, in which
+// an element occurs as many times as its count. Elements missing from
+// a counter have a count of zero, and since an element can't occur a
+// negative number of times, the counters returned by Union,
+// Intersection and SubtractPositive only have positive counts.
+
+// combine applies f to the counts of every element in a or b,
+// and returns a counter of the positive results.
+func combine[E comparable, N Number](a, b map[E]N, f func(a, b N) N) map[E]N {
+	out := make(map[E]N)
+
+	for el, cnt := range a {
+		if r := f(cnt, b[el]); r > 0 {
+			out[el] = r
+		}
+	}
+
+	for el, cnt := range b {
+		if _, ok := a[el]; ok {
+			continue
+		}
+		if r := f(0, cnt); r > 0 {
+			out[el] = r
+		}
+	}
+
+	return out
+}
+
+// Union returns the multiset union of a and b, in which each element
+// has the larger of its counts in a and b.
+func Union[E comparable, N Number](a, b map[E]N) map[E]N {
+	return combine(a, b, func(l, r N) N {
+		if l > r {
+			return l
+		}
+		return r
+	})
+}
+
+// Intersection returns the multiset intersection of a and b, in which
+// each element has the smaller of its counts in a and b.
+func Intersection[E comparable, N Number](a, b map[E]N) map[E]N {
+	return combine(a, b, func(l, r N) N {
+		if l < r {
+			return l
+		}
+		return r
+	})
+}
+
+// SubtractPositive is like Subtract, but only keeps
+// the elements whose counts are positive.
+func SubtractPositive[E comparable, N Number](a, b map[E]N) map[E]N {
+	return combine(a, b, func(l, r N) N {
+		// compare first, so unsigned counts don't wrap around
+		if l <= r {
+			return 0
+		}
+		return l - r
+	})
+}
+
+// Scale multiplies every count in the counter by factor
+// and returns a copy.
+func Scale[E comparable, N Number](ctr map[E]N, factor N) map[E]N {
+	out := make(map[E]N, len(ctr))
+
+	for el, cnt := range ctr {
+		out[el] = cnt * factor
+	}
+
+	return out
+}
+
+// Normalize divides every count in the counter by the total, so that
+// the counts sum up to 1, like the probabilities of a distribution.
+// The counts should not be negative. It panics if the counter is
+// not empty and the total is zero.
+func Normalize[E comparable, N Number](ctr map[E]N) map[E]float64 {
+	out := make(map[E]float64, len(ctr))
+	if len(ctr) == 0 {
+		return out
+	}
+
+	total := float64(Total(ctr))
+	if total == 0 {
+		panic("total is zero")
+	}
+
+	for el, cnt := range ctr {
+		out[el] = float64(cnt) / total
+	}
+
+	return out
+}
+
+// Most returns a counter of the elements that occur
+// at least threshold times.
+func Most[E comparable, N Number](ctr map[E]N, threshold N) map[E]N {
+	return filter(ctr, func(cnt N) bool { return cnt >= threshold })
+}
+
+// Least returns a counter of the elements that occur
+// at most threshold times.
+func Least[E comparable, N Number](ctr map[E]N, threshold N) map[E]N {
+	return filter(ctr, func(cnt N) bool { return cnt <= threshold })
+}
+
+func filter[E comparable, N Number](ctr map[E]N, keep func(N) bool) map[E]N {
+	out := make(map[E]N)
+
+	for el, cnt := range ctr {
+		if keep(cnt) {
+			out[el] = cnt
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,81 @@
+package counter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMultiset(t *testing.T) {
+	a := map[byte]int{'a': 3, 'b': 1, 'c': -1}
+	b := map[byte]int{'a': 1, 'b': 2, 'd': 4}
+
+	tests := []struct {
+		name string
+		f    func(a, b map[byte]int) map[byte]int
+		want map[byte]int
+	}{
+		{
+			name: "union",
+			f:    Union[byte, int],
+			want: map[byte]int{'a': 3, 'b': 2, 'd': 4},
+		},
+		{
+			name: "intersection",
+			f:    Intersection[byte, int],
+			want: map[byte]int{'a': 1, 'b': 1},
+		},
+		{
+			name: "subtract positive",
+			f:    SubtractPositive[byte, int],
+			want: map[byte]int{'a': 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			acopy, bcopy := mapcopy(a), mapcopy(b)
+
+			assert.Equal(t, tt.want, tt.f(a, b))
+			assert.Equal(t, acopy, a)
+			assert.Equal(t, bcopy, b)
+
+			assert.Equal(t, map[byte]int{}, tt.f(nil, nil))
+		})
+	}
+
+	// a missing element has a count of zero
+	assert.Equal(t, map[byte]int{'b': 1, 'c': 1, 'd': 4}, SubtractPositive(b, a))
+
+	// unsigned counts must not wrap around
+	assert.Equal(t, map[string]uint8{"b": 1},
+		SubtractPositive(
+			map[string]uint8{"a": 1, "b": 3},
+			map[string]uint8{"a": 2, "b": 2, "c": 1},
+		))
+}
+
+func TestScale(t *testing.T) {
+	ctr := map[byte]int{'a': 3, 'b': -1}
+	assert.Equal(t, map[byte]int{'a': 6, 'b': -2}, Scale(ctr, 2))
+	assert.Equal(t, map[byte]int{'a': 3, 'b': -1}, ctr)
+	assert.Equal(t, map[byte]float64{'a': 0.75}, Scale(map[byte]float64{'a': 1.5}, 0.5))
+	assert.Equal(t, map[byte]int{}, Scale(map[byte]int(nil), 2))
+}
+
+func TestNormalize(t *testing.T) {
+	assert.Equal(t, map[byte]float64{'a': 0.75, 'b': 0.25},
+		Normalize(map[byte]int{'a': 3, 'b': 1}))
+	assert.Equal(t, map[byte]float64{}, Normalize(map[byte]int(nil)))
+	assert.PanicsWithValue(t, "total is zero", func() {
+		Normalize(map[byte]int{'a': 0})
+	})
+}
+
+func TestMostLeast(t *testing.T) {
+	ctr := Counter[int]([]byte("abracadabra"))
+
+	assert.Equal(t, map[byte]int{'a': 5, 'b': 2, 'r': 2}, Most(ctr, 2))
+	assert.Equal(t, map[byte]int{}, Most(ctr, 6))
+	assert.Equal(t, map[byte]int{'b': 2, 'r': 2, 'c': 1, 'd': 1}, Least(ctr, 2))
+	assert.Equal(t, map[byte]int{}, Least(ctr, 0))
+}
@@ -0,0 +1,92 @@
+package counter
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"golang.org/x/exp/constraints"
+)
+
+// CountMin and HyperLogLog need to hash elements of any comparable
+// type, but Go has no way to do that for every such type. The caller
+// passes in a hash function instead. Sketches are only meaningful
+// together, e.g. when merged or serialized and deserialized, if they
+// use the same hash function, so it must not be randomly seeded.
+// HashString and HashInteger are suitable for common element types.
+
+var (
+	// ErrIncompatible is returned when merging two sketches
+	// that were made with different parameters.
+	ErrIncompatible = errors.New("counter: sketches are incompatible")
+	// ErrInvalidSketch is returned when deserializing data that
+	// is not a serialized sketch of the right kind.
+	ErrInvalidSketch = errors.New("counter: invalid serialized sketch")
+)
+
+// HashString hashes s with 64-bit FNV-1a. It can be passed to
+// NewCountMin and NewHyperLogLog.
+func HashString(s string) uint64 {
+	const (
+		offset = 14695981039346656037
+		prime  = 1099511628211
+	)
+
+	h := uint64(offset)
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= prime
+	}
+	return h
+}
+
+// HashInteger hashes an integer. It can be passed to
+// NewCountMin and NewHyperLogLog.
+func HashInteger[T constraints.Integer](x T) uint64 {
+	return mix64(uint64(x))
+}
+
+// mix64 is the finalizer of MurmurHash3. It spreads every bit of
+// its input over its output, so that weak hash functions, like
+// the identity function, are still usable.
+func mix64(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
+
+// sketchReader reads the uvarints of a serialized sketch,
+// remembering the first error.
+type sketchReader struct {
+	data []byte
+	err  error
+}
+
+func (r *sketchReader) magic(m string) {
+	if len(r.data) < len(m) || string(r.data[:len(m)]) != m {
+		r.err = ErrInvalidSketch
+		return
+	}
+	r.data = r.data[len(m):]
+}
+
+func (r *sketchReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	x, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		r.err = ErrInvalidSketch
+		return 0
+	}
+	r.data = r.data[n:]
+	return x
+}
+
+func appendUvarint(b []byte, x uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], x)
+	return append(b, buf[:n]...)
+}
@@ -0,0 +1,154 @@
+package counter
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCountMin(t *testing.T) {
+	const n = 10000
+	stream, exact := zipf(3, n)
+
+	c := NewCountMin(200, 5, HashInteger[uint64])
+	for _, el := range stream {
+		c.Observe(el)
+	}
+	assert.Equal(t, uint64(n), c.Total())
+
+	over := 0
+	for el, count := range exact {
+		est := c.Count(el)
+		assert.GreaterOrEqual(t, est, uint64(count), "underestimated %d", el)
+		if est > uint64(count)+2*n/200 {
+			over++
+		}
+	}
+	// each estimate is outside the bound with probability 1/32
+	assert.LessOrEqual(t, over, len(exact)/10)
+}
+
+func TestCountMin_Merge(t *testing.T) {
+	stream, _ := zipf(4, 1000)
+
+	whole := NewCountMin(50, 4, HashInteger[uint64])
+	a := NewCountMin(50, 4, HashInteger[uint64])
+	b := NewCountMin(50, 4, HashInteger[uint64])
+	for i, el := range stream {
+		whole.Observe(el)
+		if i%2 == 0 {
+			a.Observe(el)
+		} else {
+			b.Observe(el)
+		}
+	}
+
+	require.NoError(t, a.Merge(b))
+	assert.Equal(t, whole.total, a.total)
+	assert.Equal(t, whole.counts, a.counts)
+
+	assert.ErrorIs(t, a.Merge(NewCountMin(50, 3, HashInteger[uint64])),
+		ErrIncompatible)
+}
+
+func TestCountMin_Binary(t *testing.T) {
+	c := NewCountMin(20, 3, HashString)
+	for _, el := range []string{"a", "b", "a", "c", "a"} {
+		c.Observe(el)
+	}
+	c.Add("d", 1000)
+
+	data, err := c.MarshalBinary()
+	require.NoError(t, err)
+
+	// the receiving side doesn't need to know the dimensions
+	d := NewCountMin(1, 1, HashString)
+	require.NoError(t, d.UnmarshalBinary(data))
+	assert.Equal(t, uint64(1005), d.Total())
+	assert.Equal(t, c.Count("a"), d.Count("a"))
+	assert.Equal(t, c.Count("d"), d.Count("d"))
+
+	for _, bad := range [][]byte{
+		nil,
+		[]byte("HLL1"),
+		data[:len(data)-1],
+		append(data, 0),
+	} {
+		assert.ErrorIs(t, d.UnmarshalBinary(bad), ErrInvalidSketch)
+	}
+}
+
+func TestHyperLogLog(t *testing.T) {
+	tests := []struct {
+		name     string
+		distinct int
+	}{
+		{"small", 100},
+		{"large", 100000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHyperLogLog(12, HashString)
+			for i := 0; i < tt.distinct; i++ {
+				el := strconv.Itoa(i)
+				// duplicates don't count
+				h.Observe(el)
+				h.Observe(el)
+			}
+			assert.InEpsilon(t, tt.distinct, h.Count(), 0.05)
+		})
+	}
+}
+
+func TestHyperLogLog_Merge(t *testing.T) {
+	a := NewHyperLogLog(10, HashInteger[int])
+	b := NewHyperLogLog(10, HashInteger[int])
+	for i := 0; i < 6000; i++ {
+		// half of them overlap
+		if i < 4000 {
+			a.Observe(i)
+		}
+		if i >= 2000 {
+			b.Observe(i)
+		}
+	}
+
+	require.NoError(t, a.Merge(b))
+	assert.InEpsilon(t, 6000, a.Count(), 0.1)
+
+	assert.ErrorIs(t, a.Merge(NewHyperLogLog(11, HashInteger[int])),
+		ErrIncompatible)
+}
+
+func TestHyperLogLog_Binary(t *testing.T) {
+	h := NewHyperLogLog(8, HashInteger[int])
+	for i := 0; i < 1000; i++ {
+		h.Observe(i)
+	}
+
+	data, err := h.MarshalBinary()
+	require.NoError(t, err)
+
+	g := NewHyperLogLog(4, HashInteger[int])
+	require.NoError(t, g.UnmarshalBinary(data))
+	assert.Equal(t, h.p, g.p)
+	assert.Equal(t, h.regs, g.regs)
+	assert.Equal(t, h.Count(), g.Count())
+
+	for _, bad := range [][]byte{
+		nil,
+		[]byte("CMS1"),
+		data[:len(data)-1],
+		append([]byte("HLL1\x03"), make([]byte, 8)...),
+	} {
+		assert.ErrorIs(t, g.UnmarshalBinary(bad), ErrInvalidSketch)
+	}
+}
+
+func TestHashString(t *testing.T) {
+	// FNV-1a test vectors
+	assert.Equal(t, uint64(0xcbf29ce484222325), HashString(""))
+	assert.Equal(t, uint64(0xaf63dc4c8601ec8c), HashString("a"))
+}
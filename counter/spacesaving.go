@@ -0,0 +1,232 @@
+package counter
+
+import (
+	"go.lepak.sg/playground/heap"
+	"golang.org/x/exp/slices"
+)
+
+// SpaceSaving estimates the most frequent elements of a stream
+// that is too large to count exactly, using the Space-Saving
+// algorithm of Metwally, Agrawal and El Abbadi. It keeps a fixed
+// number of counters, so it uses a fixed amount of memory.
+//
+// Each count is an overestimate of the true count of its element,
+// by at most the Error of its Estimate, which is at most the total
+// number of elements observed divided by the number of counters.
+// An element that occurs more often than that is always counted.
+type SpaceSaving[E comparable] struct {
+	size  int
+	total int
+	// the most times an element that is not counted could have
+	// occurred, while there are unused counters. It's only
+	// nonzero after Merge
+	floor int
+	index map[E]*ssCounter[E]
+	// min-heap of counters by count, so the least frequent
+	// counter can be replaced
+	counters ssHeap[E]
+}
+
+// Estimate is an estimated count of an element.
+// The true count is between Count-Error and Count.
+type Estimate[E comparable] struct {
+	Entry[E, int]
+	Error int
+	// Guaranteed is true if the element is certainly among the
+	// k most frequent elements, for the k passed to TopK.
+	Guaranteed bool
+}
+
+type ssCounter[E comparable] struct {
+	Entry[E, int]
+	err int
+	i   int // index in the heap
+}
+
+type ssHeap[E comparable] []*ssCounter[E]
+
+func (h ssHeap[_]) Len() int {
+	return len(h)
+}
+
+func (h ssHeap[_]) Less(i, j int) bool {
+	return h[i].Count < h[j].Count
+}
+
+func (h ssHeap[_]) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].i = i
+	h[j].i = j
+}
+
+func (h *ssHeap[E]) Push(c *ssCounter[E]) {
+	c.i = len(*h)
+	*h = append(*h, c)
+}
+
+func (h *ssHeap[E]) Pop() *ssCounter[E] {
+	c := (*h)[len(*h)-1]
+	*h = (*h)[:len(*h)-1]
+	return c
+}
+
+// NewSpaceSaving makes a SpaceSaving with the given number of
+// counters. More counters give better estimates. To estimate the
+// k most frequent elements, use several times more than k counters.
+// It panics if size is not positive.
+func NewSpaceSaving[E comparable](size int) *SpaceSaving[E] {
+	if size <= 0 {
+		panic("invalid size")
+	}
+
+	return &SpaceSaving[E]{
+		size:     size,
+		index:    make(map[E]*ssCounter[E], size),
+		counters: make(ssHeap[E], 0, size),
+	}
+}
+
+// Observe counts one occurrence of el.
+func (s *SpaceSaving[E]) Observe(el E) {
+	s.total++
+
+	if c, ok := s.index[el]; ok {
+		c.Count++
+		heap.Fix[*ssCounter[E]](&s.counters, c.i)
+		return
+	}
+
+	if len(s.counters) < s.size {
+		c := &ssCounter[E]{
+			Entry: Entry[E, int]{Element: el, Count: s.floor + 1},
+			err:   s.floor,
+		}
+		s.index[el] = c
+		heap.Push[*ssCounter[E]](&s.counters, c)
+		return
+	}
+
+	// replace the least frequent element, which may have
+	// occurred up to its count times before el
+	c := s.counters[0]
+	delete(s.index, c.Element)
+	c.Element = el
+	c.err = c.Count
+	c.Count++
+	s.index[el] = c
+	heap.Fix[*ssCounter[E]](&s.counters, 0)
+}
+
+// Total returns the number of elements observed.
+func (s *SpaceSaving[E]) Total() int {
+	return s.total
+}
+
+// Count returns the estimate for el. If el is not counted, the
+// estimate has a Count of 0, and the most times el could have
+// occurred is returned as the Error.
+func (s *SpaceSaving[E]) Count(el E) Estimate[E] {
+	if c, ok := s.index[el]; ok {
+		return Estimate[E]{Entry: c.Entry, Error: c.err}
+	}
+	return Estimate[E]{Entry: Entry[E, int]{Element: el}, Error: s.min()}
+}
+
+// min returns the count that an element that is not counted
+// could have at most.
+func (s *SpaceSaving[E]) min() int {
+	if len(s.counters) < s.size {
+		return s.floor
+	}
+	return s.counters[0].Count
+}
+
+// TopK returns the estimates of the k most frequent elements, in
+// descending order of count. If fewer than k elements are counted,
+// all of them are returned. It panics if k is negative.
+func (s *SpaceSaving[E]) TopK(k int) []Estimate[E] {
+	if k < 0 {
+		panic("k is negative")
+	}
+
+	sorted := make([]*ssCounter[E], len(s.counters))
+	copy(sorted, s.counters)
+	slices.SortFunc(sorted, func(a, b *ssCounter[E]) bool {
+		return a.Count > b.Count
+	})
+
+	if k > len(sorted) {
+		k = len(sorted)
+	}
+
+	// the true count of any element outside the top k is
+	// at most the count of the next element
+	var next int
+	if k < len(sorted) {
+		next = sorted[k].Count
+	} else {
+		next = s.min()
+	}
+
+	out := make([]Estimate[E], k)
+	for i, c := range sorted[:k] {
+		out[i] = Estimate[E]{
+			Entry:      c.Entry,
+			Error:      c.err,
+			Guaranteed: c.Count-c.err >= next,
+		}
+	}
+	return out
+}
+
+// Merge adds the counts of other into s, as if s had also observed
+// every element that other observed. s keeps its own number of
+// counters, so the error bounds are those of s for the combined
+// stream. other is not modified.
+func (s *SpaceSaving[E]) Merge(other *SpaceSaving[E]) {
+	// an element that isn't counted by one side may have
+	// occurred up to that side's min times
+	sMin, oMin := s.min(), other.min()
+
+	merged := make([]*ssCounter[E], 0, len(s.counters)+len(other.counters))
+	for _, c := range s.counters {
+		m := *c
+		if oc, ok := other.index[c.Element]; ok {
+			m.Count += oc.Count
+			m.err += oc.err
+		} else {
+			m.Count += oMin
+			m.err += oMin
+		}
+		merged = append(merged, &m)
+	}
+	for _, oc := range other.counters {
+		if _, ok := s.index[oc.Element]; ok {
+			continue
+		}
+		m := *oc
+		m.Count += sMin
+		m.err += sMin
+		merged = append(merged, &m)
+	}
+
+	if len(merged) > s.size {
+		slices.SortFunc(merged, func(a, b *ssCounter[E]) bool {
+			return a.Count > b.Count
+		})
+		merged = merged[:s.size]
+	}
+
+	s.total += other.total
+	// an element counted by neither side. Every merged count is at
+	// least this, so when all the counters are used, the smallest
+	// count bounds this and the elements that were dropped above
+	s.floor = sMin + oMin
+	s.counters = merged
+	s.index = make(map[E]*ssCounter[E], s.size)
+	for i, c := range merged {
+		c.i = i
+		s.index[c.Element] = c
+	}
+	heap.Init[*ssCounter[E]](&s.counters)
+}
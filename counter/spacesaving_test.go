@@ -0,0 +1,117 @@
+package counter
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// zipf returns a stream of n elements where small elements are
+// much more frequent, and its exact counter.
+func zipf(seed int64, n int) ([]uint64, map[uint64]int) {
+	r := rand.New(rand.NewSource(seed))
+	z := rand.NewZipf(r, 1.5, 1, 1000)
+
+	stream := make([]uint64, n)
+	for i := range stream {
+		stream[i] = z.Uint64()
+	}
+	return stream, Counter[int](stream)
+}
+
+// checkEstimates checks that every estimate bounds the true count.
+func checkEstimates(t *testing.T, ests []Estimate[uint64], exact map[uint64]int) {
+	for _, est := range ests {
+		count := exact[est.Element]
+		assert.LessOrEqual(t, count, est.Count, "%v underestimated", est)
+		assert.GreaterOrEqual(t, count, est.Count-est.Error,
+			"%v error too small", est)
+	}
+}
+
+func TestSpaceSaving(t *testing.T) {
+	const n = 10000
+	stream, exact := zipf(1, n)
+
+	s := NewSpaceSaving[uint64](50)
+	for _, el := range stream {
+		s.Observe(el)
+	}
+	assert.Equal(t, n, s.Total())
+
+	top := s.TopK(5)
+	assert.Len(t, top, 5)
+	checkEstimates(t, top, exact)
+	for i, est := range top {
+		assert.LessOrEqual(t, est.Error, n/50)
+		if i > 0 {
+			assert.GreaterOrEqual(t, top[i-1].Count, est.Count)
+		}
+	}
+
+	// the most frequent elements stand out enough to be certain
+	want := TopK(exact, 3)
+	for i, est := range top[:3] {
+		assert.True(t, est.Guaranteed, "%v", est)
+		assert.Equal(t, want[i].Element, est.Element)
+	}
+
+	est := s.Count(123456)
+	assert.Equal(t, 0, est.Count)
+	assert.Equal(t, s.TopK(50)[49].Count, est.Error)
+}
+
+func TestSpaceSaving_Small(t *testing.T) {
+	s := NewSpaceSaving[byte](10)
+	for _, el := range []byte("abracadabra") {
+		s.Observe(el)
+	}
+
+	// there are enough counters, so the counts are exact
+	top := s.TopK(100)
+	assert.Len(t, top, 5)
+	assert.Equal(t, Estimate[byte]{
+		Entry:      Entry[byte, int]{Element: 'a', Count: 5},
+		Guaranteed: true,
+	}, top[0])
+	assert.Equal(t, Estimate[byte]{Entry: Entry[byte, int]{Element: 'z'}},
+		s.Count('z'))
+
+	assert.PanicsWithValue(t, "k is negative", func() { s.TopK(-1) })
+	assert.PanicsWithValue(t, "invalid size", func() {
+		NewSpaceSaving[byte](0)
+	})
+}
+
+func TestSpaceSaving_Merge(t *testing.T) {
+	const n = 10000
+	stream, exact := zipf(2, n)
+
+	// three workers each see part of the stream
+	var workers [3]*SpaceSaving[uint64]
+	for i := range workers {
+		workers[i] = NewSpaceSaving[uint64](50)
+	}
+	for i, el := range stream {
+		workers[i%3].Observe(el)
+	}
+
+	s := workers[0]
+	s.Merge(workers[1])
+	s.Merge(workers[2])
+	assert.Equal(t, n, s.Total())
+
+	top := s.TopK(5)
+	checkEstimates(t, top, exact)
+	want := TopK(exact, 3)
+	for i, est := range top[:3] {
+		assert.Equal(t, want[i].Element, est.Element)
+	}
+
+	// an element counted by neither side is still bounded
+	for el, count := range exact {
+		est := s.Count(el)
+		assert.LessOrEqual(t, count, est.Count+est.Error)
+	}
+}
@@ -0,0 +1,139 @@
+package counter
+
+import (
+	"math"
+
+	"golang.org/x/exp/constraints"
+	"golang.org/x/exp/slices"
+)
+
+// The functions in this file treat a counter as a sample, in which
+// each element was observed as many times as its count, like Average
+// does, except that elements whose counts are not positive are
+// left out of the sample.
+
+// Percentile returns the smallest element such that at least p percent
+// of the sample is less than or equal to it, which is the nearest-rank
+// method. The result is always an element of the counter, so it is not
+// interpolated between two elements. It panics if p is not between 0
+// and 100, or if the counter has no positive counts.
+func Percentile[E constraints.Ordered, N Number](ctr map[E]N, p float64) E {
+	if !(p >= 0 && p <= 100) {
+		panic("invalid percentile")
+	}
+
+	sorted := make([]E, 0, len(ctr))
+	for el, cnt := range ctr {
+		if cnt > 0 {
+			sorted = append(sorted, el)
+		}
+	}
+	if len(sorted) == 0 {
+		panic("ctr is empty")
+	}
+	slices.Sort(sorted)
+
+	// summed in the same order as below, so that
+	// the cumulative count reaches the total exactly
+	var total N
+	for _, el := range sorted {
+		total += ctr[el]
+	}
+
+	rank := p / 100 * float64(total)
+
+	var cum N
+	for _, el := range sorted {
+		cum += ctr[el]
+		if float64(cum) >= rank {
+			return el
+		}
+	}
+
+	return sorted[len(sorted)-1]
+}
+
+// Median returns the 50th percentile of the counter. If the middle
+// of the sample is between two elements, it returns the smaller one.
+// It panics if the counter has no positive counts.
+func Median[E constraints.Ordered, N Number](ctr map[E]N) E {
+	return Percentile(ctr, 50)
+}
+
+// Mode returns the most frequent element of the counter. If several
+// elements are the most frequent, it returns the smallest of them.
+// It panics if the counter has no positive counts.
+func Mode[E constraints.Ordered, N Number](ctr map[E]N) E {
+	var (
+		mode  E
+		max   N
+		found bool
+	)
+
+	for el, cnt := range ctr {
+		if cnt <= 0 {
+			continue
+		}
+		if !found || cnt > max || (cnt == max && el < mode) {
+			mode, max, found = el, cnt, true
+		}
+	}
+
+	if !found {
+		panic("ctr is empty")
+	}
+
+	return mode
+}
+
+// Variance returns the population variance of the counter,
+// which is the average squared distance of the sample from
+// its mean. It returns 0 if the counter has no positive counts.
+func Variance[E Number, N Number](ctr map[E]N) float64 {
+	var sum, total float64
+
+	for elem, cnt := range ctr {
+		if cnt > 0 {
+			sum += float64(elem) * float64(cnt)
+			total += float64(cnt)
+		}
+	}
+
+	if total == 0 {
+		return 0
+	}
+
+	mean := sum / total
+	sum = 0
+
+	for elem, cnt := range ctr {
+		if cnt > 0 {
+			d := float64(elem) - mean
+			sum += d * d * float64(cnt)
+		}
+	}
+
+	return sum / total
+}
+
+// Entropy returns the Shannon entropy of the counter in bits,
+// treating the normalized counts as a probability distribution.
+// It returns 0 if the counter has no positive counts.
+func Entropy[E comparable, N Number](ctr map[E]N) float64 {
+	var sum, total float64
+
+	for _, cnt := range ctr {
+		if cnt > 0 {
+			total += float64(cnt)
+		}
+	}
+
+	for _, cnt := range ctr {
+		if cnt > 0 {
+			p := float64(cnt) / total
+			sum -= p * math.Log2(p)
+		}
+	}
+
+	return sum
+}
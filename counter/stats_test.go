@@ -0,0 +1,68 @@
+package counter
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPercentile(t *testing.T) {
+	// the sample is 1 2 2 3 3 3 4 4 4 4
+	ctr := map[int]int{1: 1, 2: 2, 3: 3, 4: 4, 5: 0, 0: -1}
+
+	tests := []struct {
+		p    float64
+		want int
+	}{
+		{p: 0, want: 1},
+		{p: 10, want: 1},
+		{p: 11, want: 2},
+		{p: 30, want: 2},
+		{p: 50, want: 3},
+		{p: 60, want: 3},
+		{p: 61, want: 4},
+		{p: 100, want: 4},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Percentile(ctr, tt.p), "p = %v", tt.p)
+	}
+
+	assert.Equal(t, 3, Median(ctr))
+	assert.Equal(t, 2, Median(map[int]int{1: 1, 2: 1, 3: 1, 4: 1}))
+	assert.Equal(t, "b", Median(map[string]float64{"a": 0.25, "b": 0.5, "c": 0.25}))
+
+	for _, p := range []float64{-1, 101, math.NaN()} {
+		assert.PanicsWithValue(t, "invalid percentile", func() {
+			Percentile(ctr, p)
+		})
+	}
+	assert.PanicsWithValue(t, "ctr is empty", func() {
+		Median(map[int]int{1: 0})
+	})
+}
+
+func TestMode(t *testing.T) {
+	assert.Equal(t, byte('a'), Mode(Counter[int]([]byte("abracadabra"))))
+	// ties go to the smallest element
+	assert.Equal(t, byte('b'), Mode(map[byte]int{'r': 2, 'b': 2, 'c': 1}))
+	assert.Equal(t, 2.5, Mode(map[float64]float64{1: 0.5, 2.5: 1.5}))
+	assert.PanicsWithValue(t, "ctr is empty", func() {
+		Mode(map[byte]int(nil))
+	})
+}
+
+func TestVariance(t *testing.T) {
+	assert.InDelta(t, 0.5, Variance(map[int]int{1: 1, 2: 2, 3: 1}), 1e-9)
+	assert.InDelta(t, 4.0, Variance(map[int]int{2: 1, 4: 3, 5: 2, 7: 1, 9: 1}), 1e-9)
+	assert.InDelta(t, 0.0, Variance(map[float64]int{1.5: 10}), 1e-9)
+	assert.Equal(t, 0.0, Variance(map[int]int(nil)))
+}
+
+func TestEntropy(t *testing.T) {
+	assert.InDelta(t, 0.0, Entropy(map[byte]int{'a': 7}), 1e-9)
+	assert.InDelta(t, 1.0, Entropy(map[byte]int{'a': 3, 'b': 3, 'c': 0}), 1e-9)
+	assert.InDelta(t, 2.0, Entropy(Counter[int]([]byte("abcd"))), 1e-9)
+	assert.InDelta(t, 1.5, Entropy(map[byte]float64{'a': 0.5, 'b': 0.25, 'c': 0.25}), 1e-9)
+	assert.Equal(t, 0.0, Entropy(map[byte]int(nil)))
+}
@@ -3,63 +3,63 @@ package counter
 import "container/heap"
 
 // Entry represents an element-count pair.
-type Entry[E comparable] struct {
+type Entry[E comparable, N Number] struct {
 	Element E
-	Count   int
+	Count   N
 }
 
 // entries is used to implement a max-heap.
-type entries[E comparable] []*Entry[E]
+type entries[E comparable, N Number] []*Entry[E, N]
 
-var _ heap.Interface = (*entries[int])(nil)
+var _ heap.Interface = (*entries[int, int])(nil)
 
-func (e entries[_]) Len() int {
+func (e entries[_, _]) Len() int {
 	return len(e)
 }
 
-func (e entries[E]) Less(i, j int) bool {
+func (e entries[E, N]) Less(i, j int) bool {
 	// yes, the sign is correct
 	// see container/heap PriorityQueue example
 	return e[i].Count > e[j].Count
 }
 
-func (e entries[_]) Swap(i, j int) {
+func (e entries[_, _]) Swap(i, j int) {
 	e[i], e[j] = e[j], e[i]
 }
 
-func (e *entries[E]) Push(x any) {
-	in := x.(*Entry[E]) //...
+func (e *entries[E, N]) Push(x any) {
+	in := x.(*Entry[E, N]) //...
 
 	*e = append(*e, in)
 }
 
-func (e *entries[E]) Pop() any {
+func (e *entries[E, N]) Pop() any {
 	x := (*e)[len(*e)-1]
 	*e = (*e)[:len(*e)-1]
 	return x
 }
 
 // entriesMin is used to implement a min-heap.
-type entriesMin[E comparable] struct {
-	entries[E]
+type entriesMin[E comparable, N Number] struct {
+	entries[E, N]
 }
 
-var _ heap.Interface = (*entriesMin[int])(nil)
+var _ heap.Interface = (*entriesMin[int, int])(nil)
 
-func (e entriesMin[_]) Less(i, j int) bool {
+func (e entriesMin[_, _]) Less(i, j int) bool {
 	return e.entries[i].Count < e.entries[j].Count
 }
 
 // heapk creates either a min- or max-heap from the element-count pairs
 // in the counter, then pops off k elements and returns them.
-func heapk[E comparable](ctr map[E]int, k int, max bool) []Entry[E] {
+func heapk[E comparable, N Number](ctr map[E]N, k int, max bool) []Entry[E, N] {
 	// Is it possible to have a type parameter H
 	// that *entries[E] and *entriesMin[E] would conform to?
 	// The H must be a superset of heap.Interface
-	// and the type must be ~*[]Entry[E]
+	// and the type must be ~*[]Entry[E, N]
 
 	if k == 0 {
-		return []Entry[E]{}
+		return []Entry[E, N]{}
 	} else if k > len(ctr) {
 		// alternative: return len(ctr)-k of zero Entries
 		// at the end of the slice?
@@ -69,10 +69,10 @@ func heapk[E comparable](ctr map[E]int, k int, max bool) []Entry[E] {
 		panic("k is negative")
 	}
 
-	heapslice := make([]*Entry[E], len(ctr))
+	heapslice := make([]*Entry[E, N], len(ctr))
 	i := 0
 	for el, cnt := range ctr {
-		heapslice[i] = &Entry[E]{
+		heapslice[i] = &Entry[E, N]{
 			Element: el,
 			Count:   cnt,
 		}
@@ -82,18 +82,18 @@ func heapk[E comparable](ctr map[E]int, k int, max bool) []Entry[E] {
 	var hptr heap.Interface
 
 	if max {
-		h := entries[E](heapslice)
+		h := entries[E, N](heapslice)
 		hptr = &h
 	} else {
-		h := entriesMin[E]{entries: heapslice}
+		h := entriesMin[E, N]{entries: heapslice}
 		hptr = &h
 	}
 
 	heap.Init(hptr)
 
-	out := make([]Entry[E], k)
+	out := make([]Entry[E, N], k)
 	for i := 0; i < k; i++ {
-		entry := heap.Pop(hptr).(*Entry[E])
+		entry := heap.Pop(hptr).(*Entry[E, N])
 		out[i] = *entry
 	}
 
@@ -104,8 +104,9 @@ func heapk[E comparable](ctr map[E]int, k int, max bool) []Entry[E] {
 // The returned entries are in descending order of frequency.
 // If two elements have the same count, their relative order in
 // the returned slice is undefined, however they will be after
-// all elements that occur more frequently.
-func TopK[E comparable](ctr map[E]int, k int) []Entry[E] {
+// all elements that occur more frequently. TopKFunc breaks ties
+// deterministically.
+func TopK[E comparable, N Number](ctr map[E]N, k int) []Entry[E, N] {
 	return heapk(ctr, k, true)
 }
 
@@ -113,7 +114,8 @@ func TopK[E comparable](ctr map[E]int, k int) []Entry[E] {
 // The returned entries are in ascending order of frequency.
 // If two elements have the same count, their relative order in
 // the returned slice is undefined, however they will be after
-// all elements that occur less frequently.
-func BottomK[E comparable](ctr map[E]int, k int) []Entry[E] {
+// all elements that occur less frequently. BottomKFunc breaks ties
+// deterministically.
+func BottomK[E comparable, N Number](ctr map[E]N, k int) []Entry[E, N] {
 	return heapk(ctr, k, false)
 }
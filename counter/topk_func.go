@@ -0,0 +1,106 @@
+package counter
+
+import (
+	"go.lepak.sg/playground/heap"
+)
+
+// boundedk is a heap of at most k entries. Its root is the entry that
+// would be last in the output, so it can be replaced by a better one.
+type boundedk[E comparable, N Number] struct {
+	entries []Entry[E, N]
+	// before reports whether a comes before b in the output
+	before func(a, b Entry[E, N]) bool
+}
+
+func (h boundedk[_, _]) Len() int {
+	return len(h.entries)
+}
+
+func (h boundedk[_, _]) Less(i, j int) bool {
+	return h.before(h.entries[j], h.entries[i])
+}
+
+func (h boundedk[_, _]) Swap(i, j int) {
+	h.entries[i], h.entries[j] = h.entries[j], h.entries[i]
+}
+
+func (h *boundedk[E, N]) Push(x Entry[E, N]) {
+	h.entries = append(h.entries, x)
+}
+
+func (h *boundedk[E, N]) Pop() Entry[E, N] {
+	x := h.entries[len(h.entries)-1]
+	h.entries = h.entries[:len(h.entries)-1]
+	return x
+}
+
+// boundk returns the first k entries of the counter in the order
+// given by before, keeping only k entries in a heap at a time.
+func boundk[E comparable, N Number](
+	ctr map[E]N, k int, before func(a, b Entry[E, N]) bool,
+) []Entry[E, N] {
+	if k < 0 {
+		panic("k is negative")
+	} else if k > len(ctr) {
+		k = len(ctr)
+	}
+
+	h := boundedk[E, N]{
+		entries: make([]Entry[E, N], 0, k),
+		before:  before,
+	}
+	if k == 0 {
+		return h.entries
+	}
+
+	for el, cnt := range ctr {
+		e := Entry[E, N]{Element: el, Count: cnt}
+		if len(h.entries) < k {
+			heap.Push[Entry[E, N]](&h, e)
+		} else if before(e, h.entries[0]) {
+			h.entries[0] = e
+			heap.Fix[Entry[E, N]](&h, 0)
+		}
+	}
+
+	// popping gives the last entry first
+	out := make([]Entry[E, N], k)
+	for i := k - 1; i >= 0; i-- {
+		out[i] = heap.Pop[Entry[E, N]](&h)
+	}
+
+	return out
+}
+
+// TopKFunc returns the k most-frequent elements from the counter,
+// in descending order of frequency. Elements with the same count are
+// in ascending order according to less, so the result is always the
+// same for the same counter, provided less is a strict total order.
+// If k is larger than the number of elements in the counter, all of
+// them are returned. It panics if k is negative.
+//
+// Unlike TopK, it takes O(n log k) time and O(k) space.
+func TopKFunc[E comparable, N Number](
+	ctr map[E]N, k int, less func(a, b E) bool,
+) []Entry[E, N] {
+	return boundk(ctr, k, func(a, b Entry[E, N]) bool {
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return less(a.Element, b.Element)
+	})
+}
+
+// BottomKFunc is like TopKFunc, but returns the k least-frequent
+// elements, in ascending order of frequency. Elements with the same
+// count are still in ascending order according to less.
+func BottomKFunc[E comparable, N Number](
+	ctr map[E]N, k int, less func(a, b E) bool,
+) []Entry[E, N] {
+	return boundk(ctr, k, func(a, b Entry[E, N]) bool {
+		if a.Count != b.Count {
+			return a.Count < b.Count
+		}
+		return less(a.Element, b.Element)
+	})
+}
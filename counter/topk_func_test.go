@@ -0,0 +1,116 @@
+package counter
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/exp/slices"
+)
+
+func byteLess(a, b byte) bool {
+	return a < b
+}
+
+func TestTopKFunc(t *testing.T) {
+	tests := []struct {
+		name string
+		ctr  map[byte]int
+		k    int
+		top  []Entry[byte, int]
+		btm  []Entry[byte, int]
+	}{
+		{
+			name: "empty",
+			k:    0,
+			top:  []Entry[byte, int]{},
+			btm:  []Entry[byte, int]{},
+		},
+		{
+			name: "k larger than counter",
+			ctr:  map[byte]int{'a': 1, 'b': 2},
+			k:    5,
+			top:  []Entry[byte, int]{{'b', 2}, {'a', 1}},
+			btm:  []Entry[byte, int]{{'a', 1}, {'b', 2}},
+		},
+		{
+			name: "ties",
+			ctr:  Counter[int]([]byte("abracadabra")),
+			k:    3,
+			top:  []Entry[byte, int]{{'a', 5}, {'b', 2}, {'r', 2}},
+			btm:  []Entry[byte, int]{{'c', 1}, {'d', 1}, {'b', 2}},
+		},
+		{
+			name: "all ties",
+			ctr:  Counter[int]([]byte("zyxw")),
+			k:    2,
+			top:  []Entry[byte, int]{{'w', 1}, {'x', 1}},
+			btm:  []Entry[byte, int]{{'w', 1}, {'x', 1}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.top, TopKFunc(tt.ctr, tt.k, byteLess))
+			assert.Equal(t, tt.btm, BottomKFunc(tt.ctr, tt.k, byteLess))
+		})
+	}
+}
+
+func TestTopKFunc_Panic(t *testing.T) {
+	assert.PanicsWithValue(t, "k is negative", func() {
+		TopKFunc(map[byte]int{'a': 1}, -1, byteLess)
+	})
+	assert.PanicsWithValue(t, "k is negative", func() {
+		BottomKFunc(map[byte]int{'a': 1}, -1, byteLess)
+	})
+}
+
+func TestTopKFunc_Sorted(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	ctr := make(map[int]int)
+	for i := 0; i < 1000; i++ {
+		ctr[rng.Intn(500)] += rng.Intn(10)
+	}
+
+	sorted := make([]Entry[int, int], 0, len(ctr))
+	for el, cnt := range ctr {
+		sorted = append(sorted, Entry[int, int]{Element: el, Count: cnt})
+	}
+	slices.SortFunc(sorted, func(a, b Entry[int, int]) bool {
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Element < b.Element
+	})
+
+	less := func(a, b int) bool { return a < b }
+	for _, k := range []int{1, 10, 100, len(ctr)} {
+		assert.Equal(t, sorted[:k], TopKFunc(ctr, k, less), "k = %d", k)
+	}
+}
+
+func BenchmarkTopK(b *testing.B) {
+	less := func(a, b int) bool { return a < b }
+
+	for _, n := range []int{1000, 100000} {
+		rng := rand.New(rand.NewSource(1))
+		ctr := make(map[int]int, n)
+		for i := 0; i < n; i++ {
+			ctr[i] = rng.Intn(n)
+		}
+
+		for _, k := range []int{10, 100} {
+			b.Run(fmt.Sprintf("n=%d/k=%d/TopKAlt", n, k), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					TopKAlt(ctr, k)
+				}
+			})
+			b.Run(fmt.Sprintf("n=%d/k=%d/TopKFunc", n, k), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					TopKFunc(ctr, k, less)
+				}
+			})
+		}
+	}
+}
@@ -6,27 +6,27 @@ import (
 
 // entries2 is used to implement a max-heap.
 // Push and Pop use type parameters in their signatures.
-type entries2[E comparable] []*Entry[E]
+type entries2[E comparable, N Number] []*Entry[E, N]
 
-func (e entries2[_]) Len() int {
+func (e entries2[_, _]) Len() int {
 	return len(e)
 }
 
-func (e entries2[E]) Less(i, j int) bool {
+func (e entries2[E, N]) Less(i, j int) bool {
 	// yes, the sign is correct
 	// see container/heap PriorityQueue example
 	return e[i].Count > e[j].Count
 }
 
-func (e entries2[_]) Swap(i, j int) {
+func (e entries2[_, _]) Swap(i, j int) {
 	e[i], e[j] = e[j], e[i]
 }
 
-func (e *entries2[E]) Push(x *Entry[E]) {
+func (e *entries2[E, N]) Push(x *Entry[E, N]) {
 	*e = append(*e, x)
 }
 
-func (e *entries2[E]) Pop() *Entry[E] {
+func (e *entries2[E, N]) Pop() *Entry[E, N] {
 	x := (*e)[len(*e)-1]
 	*e = (*e)[:len(*e)-1]
 	return x
@@ -35,31 +35,31 @@ func (e *entries2[E]) Pop() *Entry[E] {
 // TopKAlt is like TopK, but fully generic, as it does not use
 // the standard library heap. (The standard library heap.Pop()
 // returns any instead of a concrete type.)
-func TopKAlt[E comparable](ctr map[E]int, k int) []Entry[E] {
+func TopKAlt[E comparable, N Number](ctr map[E]N, k int) []Entry[E, N] {
 	if k == 0 {
-		return []Entry[E]{}
+		return []Entry[E, N]{}
 	} else if k > len(ctr) {
 		panic("k is larger than number of elements in ctr")
 	} else if k < 0 {
 		panic("k is negative")
 	}
 
-	heapslice := make([]*Entry[E], len(ctr))
+	heapslice := make([]*Entry[E, N], len(ctr))
 	i := 0
 	for el, cnt := range ctr {
-		heapslice[i] = &Entry[E]{
+		heapslice[i] = &Entry[E, N]{
 			Element: el,
 			Count:   cnt,
 		}
 		i++
 	}
-	h := entries2[E](heapslice)
+	h := entries2[E, N](heapslice)
 
-	heap.Init[*Entry[E]](&h)
+	heap.Init[*Entry[E, N]](&h)
 
-	out := make([]Entry[E], k)
+	out := make([]Entry[E, N], k)
 	for i := 0; i < k; i++ {
-		entry := heap.Pop[*Entry[E]](&h)
+		entry := heap.Pop[*Entry[E, N]](&h)
 		out[i] = *entry
 	}
 
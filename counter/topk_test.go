@@ -15,11 +15,11 @@ func TestTopK(t *testing.T) {
 	tests := []struct {
 		name string
 		args args
-		want []Entry[byte]
+		want []Entry[byte, int]
 	}{
 		{
 			name: "empty",
-			want: []Entry[byte]{},
+			want: []Entry[byte, int]{},
 		},
 		{
 			name: "one",
@@ -27,7 +27,7 @@ func TestTopK(t *testing.T) {
 				ctr: map[byte]int{'a': 1},
 				k:   1,
 			},
-			want: []Entry[byte]{
+			want: []Entry[byte, int]{
 				{
 					Element: 'a',
 					Count:   1,
@@ -37,10 +37,10 @@ func TestTopK(t *testing.T) {
 		{
 			name: "two",
 			args: args{
-				ctr: Counter([]byte("aardvark")),
+				ctr: Counter[int]([]byte("aardvark")),
 				k:   2,
 			},
-			want: []Entry[byte]{
+			want: []Entry[byte, int]{
 				{
 					Element: 'a',
 					Count:   3,
@@ -104,11 +104,11 @@ func TestBottomK(t *testing.T) {
 	tests := []struct {
 		name string
 		args args
-		want []Entry[byte]
+		want []Entry[byte, int]
 	}{
 		{
 			name: "empty",
-			want: []Entry[byte]{},
+			want: []Entry[byte, int]{},
 		},
 		{
 			name: "one",
@@ -116,7 +116,7 @@ func TestBottomK(t *testing.T) {
 				ctr: map[byte]int{'a': 1},
 				k:   1,
 			},
-			want: []Entry[byte]{
+			want: []Entry[byte, int]{
 				{
 					Element: 'a',
 					Count:   1,
@@ -126,10 +126,10 @@ func TestBottomK(t *testing.T) {
 		{
 			name: "two",
 			args: args{
-				ctr: Counter([]byte("rraacecaarr")),
+				ctr: Counter[int]([]byte("rraacecaarr")),
 				k:   2,
 			},
-			want: []Entry[byte]{
+			want: []Entry[byte, int]{
 				{
 					Element: 'e',
 					Count:   1,
@@ -150,7 +150,7 @@ func TestBottomK(t *testing.T) {
 				},
 				k: 2,
 			},
-			want: []Entry[byte]{
+			want: []Entry[byte, int]{
 				{
 					Element: 'b',
 					Count:   -1,
@@ -179,11 +179,11 @@ func TestTopK2(t *testing.T) {
 	tests := []struct {
 		name string
 		args args
-		want []Entry[byte]
+		want []Entry[byte, int]
 	}{
 		{
 			name: "empty",
-			want: []Entry[byte]{},
+			want: []Entry[byte, int]{},
 		},
 		{
 			name: "one",
@@ -191,7 +191,7 @@ func TestTopK2(t *testing.T) {
 				ctr: map[byte]int{'a': 1},
 				k:   1,
 			},
-			want: []Entry[byte]{
+			want: []Entry[byte, int]{
 				{
 					Element: 'a',
 					Count:   1,
@@ -201,10 +201,10 @@ func TestTopK2(t *testing.T) {
 		{
 			name: "two",
 			args: args{
-				ctr: Counter([]byte("aardvark")),
+				ctr: Counter[int]([]byte("aardvark")),
 				k:   2,
 			},
-			want: []Entry[byte]{
+			want: []Entry[byte, int]{
 				{
 					Element: 'a',
 					Count:   3,
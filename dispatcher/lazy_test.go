@@ -197,7 +197,7 @@ func TestLazy(t *testing.T) {
 					events = append(events, e)
 				}
 
-				c := ctr.Counter(events)
+				c := ctr.Counter[int](events)
 				k := 100
 				if len(c) < k {
 					k = len(c)
@@ -238,7 +238,7 @@ func TestLazy(t *testing.T) {
 
 				assert.Equal(t, map[stringEvent]int{
 					{id: 1, value: "a"}: 10,
-				}, ctr.Counter(events))
+				}, ctr.Counter[int](events))
 			},
 		},
 	}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"go.lepak.sg/playground/batcher"
+	"go.lepak.sg/playground/clock"
 )
 
 type Batched[T any] struct {
@@ -26,6 +27,15 @@ type Batched[T any] struct {
 // must be marked.
 func NewBatched[T any](
 	max int, mark func(T), threshold int, interval time.Duration,
+) *Batched[T] {
+	return NewBatchedClock(max, mark, threshold, interval, nil)
+}
+
+// NewBatchedClock is like NewBatched, but uses clk to time the
+// interval. A nil clk is the real clock.
+func NewBatchedClock[T any](
+	max int, mark func(T), threshold int, interval time.Duration,
+	clk clock.Clock,
 ) *Batched[T] {
 	if mark == nil {
 		panic("mark must not be nil")
@@ -44,6 +54,7 @@ func NewBatched[T any](
 	batcher.Start(d.c, d.cbatch, &d.wg, batcher.Params{
 		Threshold: threshold,
 		Interval:  interval,
+		Clock:     clk,
 	})
 
 	d.wg.Add(1)
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"go.lepak.sg/playground/clock"
 	"go.uber.org/goleak"
 )
 
@@ -74,6 +75,29 @@ func TestBatched_DoneThenBatch(t *testing.T) {
 	goleak.VerifyNone(t)
 }
 
+func TestBatched_FakeClock(t *testing.T) {
+	marks := make(chan int, 10)
+	clk := clock.NewFake(time.Unix(0, 0))
+
+	dq := NewBatchedClock(10, func(i int) {
+		marks <- i
+	}, 3, time.Second, clk)
+
+	testdone(t)(dq.Start(context.Background(), 1))
+	// the batcher starts its timer once it receives the first task
+	clk.WaitTimers(1)
+	clk.Advance(time.Second - 1)
+	assert.Len(t, marks, 0)
+
+	clk.Advance(1)
+	assert.Equal(t, 1, <-marks)
+
+	dq.ShutdownWait()
+	close(marks)
+	assert.Len(t, marks, 0)
+	goleak.VerifyNone(t)
+}
+
 func testdone(t *testing.T) func(task *Task[int], err error) {
 	return func(task *Task[int], err error) {
 		assert.NoError(t, err)